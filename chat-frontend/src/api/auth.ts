@@ -20,6 +20,11 @@ export const authApi = {
   // 更新用户信息
   updateProfile: (data: Partial<User>) => {
     return request.put<{ user: User }>('/users/profile', data)
+  },
+  
+  // 设置是否隐藏已读回执
+  updatePrivacy: (hideReadReceipts: boolean) => {
+    return request.put<{ hide_read_receipts: boolean }>('/users/privacy', { hide_read_receipts: hideReadReceipts })
   }
 }
 
@@ -1,5 +1,6 @@
 import type {
     CreateRoomRequest,
+    Message,
     MessageResponse,
     MessagesResponse,
     RoomResponse,
@@ -25,6 +26,11 @@ export const chatApi = {
     return request.post<RoomResponse>('/rooms', data)
   },
   
+  // 打开与某个用户的私聊，已存在时返回原来的房间
+  openDM: (userId: number) => {
+    return request.post<RoomResponse>(`/dms/${userId}`)
+  },
+  
   // 获取房间详情
   getRoom: (roomId: number) => {
     return request.get<RoomResponse>(`/rooms/${roomId}`)
@@ -52,6 +58,38 @@ export const chatApi = {
     return request.post<MessageResponse>('/messages', data)
   },
   
+  // 编辑消息
+  editMessage: (messageId: number, content: string) => {
+    return request.put<MessageResponse>(`/messages/${messageId}`, { content })
+  },
+  
+  // 删除消息，scope为me时只对自己隐藏
+  deleteMessage: (messageId: number, scope: 'everyone' | 'me' = 'everyone') => {
+    return request.delete(`/messages/${messageId}`, { params: { scope } })
+  },
+  
+  // 添加表情回应
+  addReaction: (messageId: number, emoji: string) => {
+    return request.post(`/messages/${messageId}/reactions`, { emoji })
+  },
+  
+  // 取消表情回应
+  removeReaction: (messageId: number, emoji: string) => {
+    return request.delete(`/messages/${messageId}/reactions/${encodeURIComponent(emoji)}`)
+  },
+  
+  // 获取消息的已读和送达成员
+  getReceipts: (messageId: number) => {
+    return request.get<{ message_id: number; read_by: { user: User; last_read: string }[]; delivered_to: { user: User; last_read: string }[] }>(`/messages/${messageId}/receipts`)
+  },
+  
+  // 获取消息的回复
+  getThread: (messageId: number, page = 1, pageSize = 20) => {
+    return request.get<MessagesResponse & { root: Message }>(`/messages/${messageId}/thread`, {
+      params: { page, page_size: pageSize }
+    })
+  },
+  
   // 标记消息已读
   markAsRead: (roomId: number) => {
     return request.post(`/rooms/${roomId}/read`)
@@ -59,7 +97,7 @@ export const chatApi = {
   
   // 获取未读消息数
   getUnreadCount: (roomId: number) => {
-    return request.get<{ unread_count: number }>(`/rooms/${roomId}/unread`)
+    return request.get<{ unread_count: number; mention_count: number }>(`/rooms/${roomId}/unread`)
   },
   
   // 获取房间成员
@@ -70,6 +108,16 @@ export const chatApi = {
   // 添加成员到房间
   addMember: (roomId: number, userId: number) => {
     return request.post(`/rooms/${roomId}/members`, { user_id: userId })
+  },
+  
+  // 搜索自己所在房间的消息，使用返回的next_cursor获取更早的结果
+  searchMessages: (params: { q: string; room_id?: number; sender_id?: number; from?: string; to?: string; cursor?: number; page_size?: number }) => {
+    return request.get<{ results: { message: Message; snippet: string }[]; next_cursor: number }>('/search/messages', { params })
+  },
+  
+  // 获取WebSocket连接票据（一次性，30秒内有效）
+  getWSTicket: () => {
+    return request.post<{ ticket: string; expires_in: number }>('/ws/ticket')
   }
 }
 
@@ -1,3 +1,4 @@
+import { chatApi } from '@/api/chat'
 import { useAuthStore } from '@/stores/auth'
 import { onUnmounted, ref } from 'vue'
 
@@ -10,13 +11,15 @@ export function useWebSocket() {
   
   const messageHandlers: Array<(data: any) => void> = []
   
-  const connect = () => {
+  const connect = async () => {
     const authStore = useAuthStore()
     if (!authStore.token) return
     
-    const wsUrl = `ws://localhost:8080/api/v1/ws?token=${authStore.token}`
-    
     try {
+      // 每次连接（包括重连）都需要新的一次性票据，避免把token放在URL中
+      const { data } = await chatApi.getWSTicket()
+      const wsUrl = `ws://localhost:8080/api/v1/ws?ticket=${encodeURIComponent(data.ticket)}`
+      
       socket.value = new WebSocket(wsUrl)
       
       socket.value.onopen = () => {
@@ -14,6 +14,7 @@ export interface ChatRoom {
   members?: User[]
   last_message?: Message
   unread_count?: number
+  mention_count?: number
 }
 
 export interface Message {
@@ -23,13 +24,25 @@ export interface Message {
   sender?: User
   content: string
   type: 'text' | 'image' | 'file'
+  reply_to_id?: number | null
+  reply_count?: number
+  last_reply_at?: string | null
+  edited_at?: string | null
+  is_deleted?: boolean
+  reactions?: ReactionSummary[]
   created_at: string
   updated_at: string
   is_read: boolean
 }
 
+export interface ReactionSummary {
+  emoji: string
+  count: number
+  reacted_by_me: boolean
+}
+
 export interface CreateRoomRequest {
-  name: string
+  name?: string
   description?: string
   type: 'single' | 'group'
   member_ids: number[]
@@ -39,6 +52,7 @@ export interface SendMessageRequest {
   room_id: number
   content: string
   type: 'text' | 'image' | 'file'
+  reply_to_id?: number
 }
 
 export interface MessageResponse {
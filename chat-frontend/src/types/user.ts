@@ -3,9 +3,12 @@ export interface User {
   username: string
   nickname: string
   email: string
+  pending_email?: string
   avatar?: string
   status: 'active' | 'inactive' | 'offline'
   role?: string
+  totp_enabled?: boolean
+  hide_read_receipts?: boolean
   created_at: string
   updated_at: string
 }
@@ -5,6 +5,7 @@ import (
 	"chat-service/internal/config"
 	"chat-service/internal/database"
 	"chat-service/pkg/cache"
+	"chat-service/pkg/mail"
 	"chat-service/pkg/queue"
 	"context"
 	"fmt"
@@ -33,6 +34,11 @@ func main() {
 		log.Fatalf("Redis初始化失败: %v", err)
 	}
 
+	// 初始化邮件发送器
+	if err := mail.InitMailer(&cfg.Mail); err != nil {
+		log.Fatalf("邮件发送器初始化失败: %v", err)
+	}
+
 	// 初始化RabbitMQ
 	if err := queue.InitRabbitMQ(&cfg.RabbitMQ); err != nil {
 		log.Printf("RabbitMQ初始化失败: %v", err)
@@ -18,12 +18,18 @@ CREATE TABLE IF NOT EXISTS users (
     email varchar(100) NOT NULL,
     password varchar(255) NOT NULL,
     status varchar(20) DEFAULT 'active',
+    role varchar(20) DEFAULT 'user',
     created_at datetime(3) NULL,
     updated_at datetime(3) NULL,
     deleted_at datetime(3) NULL,
+    totp_secret varchar(64) DEFAULT NULL,
+    totp_enabled tinyint(1) DEFAULT '0',
+    pending_email varchar(100) DEFAULT NULL,
+    hide_read_receipts tinyint(1) DEFAULT '0',
     PRIMARY KEY (id),
     UNIQUE KEY idx_users_username (username),
     UNIQUE KEY idx_users_email (email),
+    KEY idx_users_pending_email (pending_email),
     KEY idx_users_deleted_at (deleted_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
@@ -36,12 +42,19 @@ CREATE TABLE IF NOT EXISTS chat_rooms (
     avatar varchar(255) DEFAULT NULL,
     owner_id bigint unsigned NOT NULL,
     max_members int DEFAULT '100',
+    only_admins_post tinyint(1) DEFAULT '0',
+    only_admins_invite tinyint(1) DEFAULT '0',
+    visibility varchar(20) DEFAULT 'invite_only',
+    archived_at datetime(3) NULL,
+    dm_key varchar(50) DEFAULT NULL,
     created_at datetime(3) NULL,
     updated_at datetime(3) NULL,
     deleted_at datetime(3) NULL,
     PRIMARY KEY (id),
     KEY idx_chat_rooms_owner_id (owner_id),
     KEY idx_chat_rooms_deleted_at (deleted_at),
+    KEY idx_chat_rooms_visibility (visibility),
+    UNIQUE KEY idx_chat_rooms_dm_key (dm_key),
     CONSTRAINT fk_chat_rooms_owner FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
@@ -53,6 +66,8 @@ CREATE TABLE IF NOT EXISTS room_members (
     role varchar(20) DEFAULT 'member',
     joined_at datetime(3) NULL,
     last_read datetime(3) NULL,
+    last_read_message_id bigint unsigned DEFAULT '0',
+    last_delivered_message_id bigint unsigned DEFAULT '0',
     created_at datetime(3) NULL,
     updated_at datetime(3) NULL,
     deleted_at datetime(3) NULL,
@@ -64,6 +79,58 @@ CREATE TABLE IF NOT EXISTS room_members (
     CONSTRAINT fk_room_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 房间封禁表
+CREATE TABLE IF NOT EXISTS room_bans (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    room_id bigint unsigned NOT NULL,
+    user_id bigint unsigned NOT NULL,
+    banned_by bigint unsigned NOT NULL,
+    reason varchar(255) DEFAULT NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_room_bans_room_user (room_id, user_id),
+    CONSTRAINT fk_room_bans_room FOREIGN KEY (room_id) REFERENCES chat_rooms (id) ON DELETE CASCADE,
+    CONSTRAINT fk_room_bans_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 房间邀请码表
+CREATE TABLE IF NOT EXISTS room_invites (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    room_id bigint unsigned NOT NULL,
+    code varchar(32) NOT NULL,
+    created_by bigint unsigned NOT NULL,
+    role varchar(20) DEFAULT 'member',
+    max_uses bigint DEFAULT '0',
+    uses bigint DEFAULT '0',
+    expires_at datetime(3) NULL,
+    revoked_at datetime(3) NULL,
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_room_invites_code (code),
+    KEY idx_room_invites_room_id (room_id),
+    CONSTRAINT fk_room_invites_room FOREIGN KEY (room_id) REFERENCES chat_rooms (id) ON DELETE CASCADE,
+    CONSTRAINT fk_room_invites_creator FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 加入房间申请表
+CREATE TABLE IF NOT EXISTS room_join_requests (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    room_id bigint unsigned NOT NULL,
+    user_id bigint unsigned NOT NULL,
+    message varchar(255) DEFAULT NULL,
+    status varchar(20) DEFAULT 'pending',
+    reviewed_by bigint unsigned DEFAULT NULL,
+    reviewed_at datetime(3) NULL,
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    KEY idx_room_join_requests_room_status (room_id, status),
+    KEY idx_room_join_requests_user_id (user_id),
+    CONSTRAINT fk_room_join_requests_room FOREIGN KEY (room_id) REFERENCES chat_rooms (id) ON DELETE CASCADE,
+    CONSTRAINT fk_room_join_requests_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- 消息表
 CREATE TABLE IF NOT EXISTS messages (
     id bigint unsigned NOT NULL AUTO_INCREMENT,
@@ -73,6 +140,9 @@ CREATE TABLE IF NOT EXISTS messages (
     type varchar(20) DEFAULT 'text',
     reply_to_id bigint unsigned DEFAULT NULL,
     is_deleted tinyint(1) DEFAULT '0',
+    reply_count bigint DEFAULT '0',
+    last_reply_at datetime(3) NULL,
+    edited_at datetime(3) NULL,
     created_at datetime(3) NULL,
     updated_at datetime(3) NULL,
     deleted_at datetime(3) NULL,
@@ -80,12 +150,67 @@ CREATE TABLE IF NOT EXISTS messages (
     KEY idx_messages_room_id (room_id),
     KEY idx_messages_sender_id (sender_id),
     KEY idx_messages_reply_to_id (reply_to_id),
+    FULLTEXT KEY idx_messages_content (content) WITH PARSER ngram,
     KEY idx_messages_deleted_at (deleted_at),
     CONSTRAINT fk_messages_room FOREIGN KEY (room_id) REFERENCES chat_rooms (id) ON DELETE CASCADE,
     CONSTRAINT fk_messages_sender FOREIGN KEY (sender_id) REFERENCES users (id) ON DELETE CASCADE,
     CONSTRAINT fk_messages_reply_to FOREIGN KEY (reply_to_id) REFERENCES messages (id) ON DELETE SET NULL
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 消息编辑历史表
+CREATE TABLE IF NOT EXISTS message_edits (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    message_id bigint unsigned NOT NULL,
+    content longtext,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    KEY idx_message_edits_message_id (message_id),
+    CONSTRAINT fk_message_edits_message FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 仅对自己删除的消息
+CREATE TABLE IF NOT EXISTS hidden_messages (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    message_id bigint unsigned NOT NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_hidden_messages_user_message (user_id, message_id),
+    KEY idx_hidden_messages_message_id (message_id),
+    CONSTRAINT fk_hidden_messages_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_hidden_messages_message FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 消息表情回应表
+CREATE TABLE IF NOT EXISTS message_reactions (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    message_id bigint unsigned NOT NULL,
+    user_id bigint unsigned NOT NULL,
+    emoji varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_message_reactions_message_user_emoji (message_id, user_id, emoji),
+    KEY idx_message_reactions_user_id (user_id),
+    CONSTRAINT fk_message_reactions_message FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE,
+    CONSTRAINT fk_message_reactions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 消息@记录表
+CREATE TABLE IF NOT EXISTS message_mentions (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    message_id bigint unsigned NOT NULL,
+    room_id bigint unsigned NOT NULL,
+    user_id bigint unsigned NOT NULL,
+    kind varchar(10) DEFAULT NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_message_mentions_message_user (message_id, user_id),
+    KEY idx_message_mentions_user_room (user_id, room_id),
+    CONSTRAINT fk_message_mentions_message FOREIGN KEY (message_id) REFERENCES messages (id) ON DELETE CASCADE,
+    CONSTRAINT fk_message_mentions_room FOREIGN KEY (room_id) REFERENCES chat_rooms (id) ON DELETE CASCADE,
+    CONSTRAINT fk_message_mentions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- 未读消息表
 CREATE TABLE IF NOT EXISTS unread_messages (
     id bigint unsigned NOT NULL AUTO_INCREMENT,
@@ -117,6 +242,117 @@ CREATE TABLE IF NOT EXISTS online_users (
     CONSTRAINT fk_online_users_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 登录会话表
+CREATE TABLE IF NOT EXISTS sessions (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    device_name varchar(100) DEFAULT NULL,
+    user_agent varchar(255) DEFAULT NULL,
+    ip varchar(64) DEFAULT NULL,
+    last_used_at datetime(3) NULL,
+    revoked_at datetime(3) NULL,
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    KEY idx_sessions_user_id (user_id),
+    KEY idx_sessions_revoked_at (revoked_at),
+    CONSTRAINT fk_sessions_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 刷新token表
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    session_id bigint unsigned NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    family_id varchar(64) NOT NULL,
+    expires_at datetime(3) NULL,
+    used_at datetime(3) NULL,
+    revoked_at datetime(3) NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_refresh_tokens_token_hash (token_hash),
+    KEY idx_refresh_tokens_user_id (user_id),
+    KEY idx_refresh_tokens_session_id (session_id),
+    KEY idx_refresh_tokens_family_id (family_id),
+    CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_refresh_tokens_session FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 重置密码token表
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at datetime(3) NULL,
+    used_at datetime(3) NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_password_reset_tokens_token_hash (token_hash),
+    KEY idx_password_reset_tokens_user_id (user_id),
+    CONSTRAINT fk_password_reset_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 两步验证恢复码表
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at datetime(3) NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_recovery_codes_code_hash (code_hash),
+    KEY idx_recovery_codes_user_id (user_id),
+    CONSTRAINT fk_recovery_codes_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 外部身份关联表
+CREATE TABLE IF NOT EXISTS user_identities (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    provider varchar(255) NOT NULL,
+    subject varchar(255) NOT NULL,
+    email varchar(100) DEFAULT NULL,
+    created_at datetime(3) NULL,
+    updated_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_user_identities_provider_subject (provider, subject),
+    KEY idx_user_identities_user_id (user_id),
+    CONSTRAINT fk_user_identities_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 个人访问token表
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    user_id bigint unsigned NOT NULL,
+    name varchar(100) DEFAULT NULL,
+    token_hash varchar(64) NOT NULL,
+    prefix varchar(20) DEFAULT NULL,
+    scopes varchar(255) DEFAULT NULL,
+    expires_at datetime(3) NULL,
+    last_used_at datetime(3) NULL,
+    revoked_at datetime(3) NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY idx_personal_access_tokens_token_hash (token_hash),
+    KEY idx_personal_access_tokens_user_id (user_id),
+    CONSTRAINT fk_personal_access_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 登录失败审计表
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id bigint unsigned NOT NULL AUTO_INCREMENT,
+    username varchar(100) DEFAULT NULL,
+    ip varchar(64) DEFAULT NULL,
+    user_agent varchar(255) DEFAULT NULL,
+    reason varchar(30) DEFAULT NULL,
+    created_at datetime(3) NULL,
+    PRIMARY KEY (id),
+    KEY idx_login_attempts_username (username),
+    KEY idx_login_attempts_ip (ip),
+    KEY idx_login_attempts_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- 添加索引以提高查询性能
 CREATE INDEX IF NOT EXISTS idx_messages_room_created ON messages (room_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_room_members_user_joined ON room_members (user_id, joined_at DESC);
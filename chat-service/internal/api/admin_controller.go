@@ -0,0 +1,110 @@
+package api
+
+import (
+	"chat-service/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type AdminController struct {
+	loginGuardService *service.LoginGuardService
+}
+
+func NewAdminController() *AdminController {
+	return &AdminController{
+		loginGuardService: service.NewLoginGuardService(),
+	}
+}
+
+// 解除用户的登录锁定
+func (c *AdminController) UnlockUser(ctx *gin.Context) {
+	userID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	if err := c.loginGuardService.Unlock(uint(userID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "解除锁定失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "已解除登录锁定"})
+}
+
+// 关联LDAP账号请求结构
+type LinkLDAPRequest struct {
+	DN string `json:"dn" binding:"required,max=255"`
+}
+
+// 将目录账号关联到已有的本地用户，LDAP登录不会按邮箱自动关联
+func (c *AdminController) LinkLDAPAccount(ctx *gin.Context) {
+	userID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req LinkLDAPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := service.LinkLDAPIdentity(uint(userID), req.DN); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		case errors.Is(err, service.ErrIdentityLinked):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "关联LDAP账号失败"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "已关联LDAP账号"})
+}
+
+// 获取用户的登录失败记录
+func (c *AdminController) GetLoginFailures(ctx *gin.Context) {
+	userID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	attempts, err := c.loginGuardService.GetFailures(uint(userID), page, pageSize)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录记录失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"attempts":  attempts,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -3,12 +3,14 @@ package api
 import (
 	"chat-service/internal/config"
 	"chat-service/internal/middleware"
+	"chat-service/internal/models"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,6 +42,33 @@ func TestHealthCheck(t *testing.T) {
 	assert.Equal(t, "chat-service", response["service"])
 }
 
+func TestClientIPIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	clientIP := func(cfg *config.Config, remoteAddr, forwardedFor string) string {
+		router := SetupRouter(cfg)
+		router.GET("/ip", func(c *gin.Context) {
+			c.String(http.StatusOK, c.ClientIP())
+		})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/ip", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	// 默认不信任任何代理，伪造的X-Forwarded-For不影响登录限制按IP计数
+	cfg := &config.Config{Server: config.ServerConfig{Mode: "test"}}
+	assert.Equal(t, "203.0.113.7", clientIP(cfg, "203.0.113.7:40000", "198.51.100.1"))
+
+	// 来自受信任代理的请求使用X-Forwarded-For
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8"}
+	assert.Equal(t, "198.51.100.1", clientIP(cfg, "10.0.0.2:40000", "198.51.100.1"))
+	assert.Equal(t, "203.0.113.7", clientIP(cfg, "203.0.113.7:40000", "198.51.100.1"))
+}
+
 func TestJWTMiddleware(t *testing.T) {
 	cfg := &config.Config{
 		JWT: config.JWTConfig{
@@ -77,3 +106,135 @@ func TestJWTMiddleware(t *testing.T) {
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
+
+func TestJWTMiddlewareRequiresVerifiedEmail(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:     "test-secret",
+			ExpireHour: 1,
+		},
+		Auth: config.AuthConfig{
+			RequireEmailVerification: true,
+		},
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("config", cfg)
+		c.Next()
+	})
+	router.Use(middleware.JWTAuth(&cfg.JWT))
+	router.GET("/protected", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "success"})
+	})
+
+	// 未验证邮箱的token被拒绝
+	token, err := middleware.GenerateSessionToken(1, 0, true, &cfg.JWT)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 已验证邮箱的token正常通过
+	token, err = middleware.GenerateSessionToken(1, 0, false, &cfg.JWT)
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestScopeMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// 模拟JWTAuth对个人访问token设置的上下文
+	withToken := func(scopes ...string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("user_id", uint(1))
+			if scopes != nil {
+				c.Set("personal_token_id", uint(1))
+				c.Set("token_scopes", scopes)
+			}
+			c.Next()
+		}
+	}
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	tests := []struct {
+		name   string
+		auth   gin.HandlerFunc
+		guard  gin.HandlerFunc
+		status int
+	}{
+		{"会话token不受权限限制", withToken(), middleware.RequireScope(middleware.ScopeRoomsWrite), http.StatusOK},
+		{"个人token具有权限", withToken(middleware.ScopeRoomsRead), middleware.RequireScope(middleware.ScopeRoomsRead), http.StatusOK},
+		{"个人token缺少权限", withToken(middleware.ScopeRoomsRead), middleware.RequireScope(middleware.ScopeRoomsWrite), http.StatusForbidden},
+		{"会话token访问敏感接口", withToken(), middleware.SessionOnly(), http.StatusOK},
+		{"个人token访问敏感接口", withToken(middleware.AllScopes...), middleware.SessionOnly(), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/test", tt.auth, tt.guard, ok)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/test", nil)
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	// token不能通过URL参数传递
+	router := gin.New()
+	router.Use(middleware.JWTAuth(&config.JWTConfig{Secret: "test-secret"}))
+	router.GET("/protected", ok)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/protected?token="+middleware.PersonalTokenPrefix+"abc", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestScrubPath(t *testing.T) {
+	assert.Equal(t, "/api/v1/rooms", middleware.ScrubPath("/api/v1/rooms"))
+	assert.Equal(t, "/api/v1/ws?ticket=***", middleware.ScrubPath("/api/v1/ws?ticket=abc123"))
+	assert.Equal(t, "/cb?code=***&state=xyz&TOKEN=***", middleware.ScrubPath("/cb?code=secret&state=xyz&TOKEN=jwt"))
+}
+
+func TestUserProfileOnlyExposesPrivateFieldsToSelf(t *testing.T) {
+	user := &models.User{ID: 1, Username: "alice", Role: "admin", TOTPEnabled: true, HideReadReceipts: true}
+
+	public, _ := json.Marshal(user)
+	var publicFields map[string]interface{}
+	json.Unmarshal(public, &publicFields)
+	assert.NotContains(t, publicFields, "role")
+	assert.NotContains(t, publicFields, "totp_enabled")
+	assert.NotContains(t, publicFields, "hide_read_receipts")
+
+	profile, _ := json.Marshal(newUserProfile(user))
+	var profileFields map[string]interface{}
+	json.Unmarshal(profile, &profileFields)
+	assert.Equal(t, "alice", profileFields["username"])
+	assert.Equal(t, "admin", profileFields["role"])
+	assert.Equal(t, true, profileFields["totp_enabled"])
+	assert.Equal(t, true, profileFields["hide_read_receipts"])
+}
+
+func TestCreateRoomRequestNameRequiredOnlyForGroups(t *testing.T) {
+	dm := CreateRoomRequest{Type: "single", MemberIDs: []uint{2}}
+	assert.NoError(t, binding.Validator.ValidateStruct(&dm))
+
+	group := CreateRoomRequest{Type: "group", MemberIDs: []uint{2}}
+	assert.Error(t, binding.Validator.ValidateStruct(&group))
+
+	group.Name = "a"
+	assert.Error(t, binding.Validator.ValidateStruct(&group))
+
+	group.Name = "项目组"
+	assert.NoError(t, binding.Validator.ValidateStruct(&group))
+}
@@ -2,18 +2,30 @@ package api
 
 import (
 	"chat-service/internal/config"
-	"chat-service/internal/middleware"
 	"chat-service/internal/models"
 	"chat-service/internal/service"
+	"chat-service/internal/websocket"
+	"chat-service/pkg/cache"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type AuthController struct {
-	userService *service.UserService
+	userService         *service.UserService
+	authService         *service.AuthService
+	passwordService     *service.PasswordService
+	verificationService *service.VerificationService
+	twoFactorService    *service.TwoFactorService
+	loginGuardService   *service.LoginGuardService
 }
 
 type ChatController struct {
@@ -22,12 +34,19 @@ type ChatController struct {
 }
 
 type UserController struct {
-	userService *service.UserService
+	userService         *service.UserService
+	passwordService     *service.PasswordService
+	verificationService *service.VerificationService
 }
 
 func NewAuthController() *AuthController {
 	return &AuthController{
-		userService: service.NewUserService(),
+		userService:         service.NewUserService(),
+		authService:         service.NewAuthService(),
+		passwordService:     service.NewPasswordService(),
+		verificationService: service.NewVerificationService(),
+		twoFactorService:    service.NewTwoFactorService(),
+		loginGuardService:   service.NewLoginGuardService(),
 	}
 }
 
@@ -40,7 +59,9 @@ func NewChatController() *ChatController {
 
 func NewUserController() *UserController {
 	return &UserController{
-		userService: service.NewUserService(),
+		userService:         service.NewUserService(),
+		passwordService:     service.NewPasswordService(),
+		verificationService: service.NewVerificationService(),
 	}
 }
 
@@ -49,21 +70,82 @@ type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Nickname string `json:"nickname" binding:"required,min=2,max=100"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6,max=50"`
+	Password string `json:"password" binding:"required"` // 强度由password配置的策略校验
 }
 
 // 登录请求结构
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"device_name" binding:"max=100"`
+}
+
+// 两步验证登录请求结构，Code可以是验证码或恢复码
+type LoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// 刷新token请求结构
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// 登出请求结构
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// 修改密码请求结构
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// 忘记密码请求结构
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// 重置密码请求结构
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// 邮箱验证请求结构
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// 重发验证邮件请求结构
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
 }
 
 // 创建房间请求结构
 type CreateRoomRequest struct {
-	Name        string `json:"name" binding:"required,min=2,max=100"`
+	Name        string `json:"name" binding:"required_if=Type group,omitempty,min=2,max=100"` // 单聊的名称取对方昵称，可以不填
 	Description string `json:"description" binding:"max=500"`
 	Type        string `json:"type" binding:"required,oneof=single group"`
 	MemberIDs   []uint `json:"member_ids" binding:"required,min=1"`
+	MaxMembers  int    `json:"max_members" binding:"omitempty,min=2"` // 为0时使用room.default_max_members
+
+	OnlyAdminsPost   bool   `json:"only_admins_post"`
+	OnlyAdminsInvite bool   `json:"only_admins_invite"`
+	Visibility       string `json:"visibility" binding:"omitempty,oneof=public invite_only request_to_join"`
+}
+
+// 修改房间请求结构，未提供的字段保持不变
+type UpdateRoomRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=2,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+	Avatar      *string `json:"avatar" binding:"omitempty,max=255"`
+	MaxMembers  *int    `json:"max_members" binding:"omitempty,min=2"`
+
+	OnlyAdminsPost   *bool   `json:"only_admins_post"`
+	OnlyAdminsInvite *bool   `json:"only_admins_invite"`
+	Visibility       *string `json:"visibility" binding:"omitempty,oneof=public invite_only request_to_join"`
 }
 
 // 发送消息请求结构
@@ -71,6 +153,8 @@ type SendMessageRequest struct {
 	RoomID  uint   `json:"room_id" binding:"required"`
 	Content string `json:"content" binding:"required,max=1000"`
 	Type    string `json:"type" binding:"required,oneof=text image file"`
+	// 回复的消息ID，回复话题中的回复时归到同一话题下
+	ReplyToID *uint `json:"reply_to_id"`
 }
 
 // 认证相关接口
@@ -87,6 +171,23 @@ func (c *AuthController) Register(ctx *gin.Context) {
 		return
 	}
 
+	// 检查密码强度
+	cfg := ctx.MustGet("config").(*config.Config)
+	if err := service.ValidatePassword(req.Password, &cfg.Password); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 邮箱被过期未验证的注册占用时会被释放
+	if err := c.verificationService.ReleaseEmail(req.Email, 0, cfg); err != nil {
+		if errors.Is(err, service.ErrEmailInUse) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "用户创建失败"})
+		return
+	}
+
 	// 密码加密
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -99,26 +200,41 @@ func (c *AuthController) Register(ctx *gin.Context) {
 		Nickname: req.Nickname,
 		Email:    req.Email,
 		Password: string(hashedPassword),
-		Status:   "active",
+		Status:   models.UserStatusPendingVerification,
 	}
 
 	if err := c.userService.CreateUser(user); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "用户名或邮箱已存在"})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "用户创建失败"})
 		return
 	}
 
+	// 发送邮箱验证链接
+	if err := c.verificationService.SendVerificationEmail(user, user.Email, cfg); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "验证邮件发送失败"})
+		return
+	}
+
+	// 要求验证邮箱时，验证完成后才能登录
+	if cfg.Auth.RequireEmailVerification {
+		ctx.JSON(http.StatusCreated, gin.H{
+			"user":    newUserProfile(user),
+			"message": "注册成功，请查收验证邮件",
+		})
+		return
+	}
+
 	// 生成JWT token
-	cfg := ctx.MustGet("config").(*config.Config)
-	token, err := middleware.GenerateToken(user.ID, &cfg.JWT)
+	tokens, err := c.authService.IssueTokens(user.ID, sessionInfo(ctx, ""), &cfg.JWT)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "token生成失败"})
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	ctx.JSON(http.StatusCreated, tokenResponse(user, tokens))
 }
 
 func (c *AuthController) Login(ctx *gin.Context) {
@@ -128,30 +244,333 @@ func (c *AuthController) Login(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.userService.GetUserByUsername(req.Username)
+	// 账号或IP处于锁定、退避期间时直接拒绝，不校验密码
+	ip, userAgent := ctx.ClientIP(), ctx.Request.UserAgent()
+	if !c.checkLoginGuard(ctx, req.Username, ip, userAgent) {
+		return
+	}
+
+	// 按auth.backends配置依次尝试LDAP、本地密码等认证方式
+	cfg := ctx.MustGet("config").(*config.Config)
+	user, err := service.Authenticate(cfg, req.Username, req.Password)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			if err := c.loginGuardService.RecordFailure(req.Username, ip, userAgent, service.LoginFailureInvalidCredentials, &cfg.Auth); err != nil {
+				log.Printf("记录登录失败次数失败: %v", err)
+			}
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+		case errors.Is(err, service.ErrLDAPAccountNotFound):
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrLDAPEmailInUse):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			log.Printf("登录认证失败: %v", err)
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "认证服务暂不可用"})
+		}
+		return
+	}
+
+	c.completeLogin(ctx, user, req.Username, req.DeviceName)
+}
+
+// checkLoginGuard 用户名或IP处于锁定、退避期间时返回错误响应和false
+func (c *AuthController) checkLoginGuard(ctx *gin.Context, username, ip, userAgent string) bool {
+	err := c.loginGuardService.Check(username, ip)
+	if err == nil {
+		return true
+	}
+
+	var blocked *service.LoginBlockedError
+	if errors.As(err, &blocked) {
+		c.loginGuardService.RecordBlocked(username, ip, userAgent, blocked)
+		ctx.Header("Retry-After", strconv.Itoa(int(blocked.RetryAfter.Seconds())+1))
+		status := http.StatusTooManyRequests
+		if blocked.Locked {
+			status = http.StatusLocked
+		}
+		ctx.JSON(status, gin.H{"error": blocked.Error(), "retry_after": int(blocked.RetryAfter.Seconds()) + 1})
+		return false
+	}
+	log.Printf("登录限制检查失败: %v", err)
+	ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "认证服务暂不可用"})
+	return false
+}
+
+// completeLogin 身份校验通过后的公共登录流程：检查邮箱验证状态，
+// 开启两步验证时返回挑战token，否则创建会话并签发JWT。
+// loginName为登录失败计数使用的用户名，两步验证完成后才清除其失败计数
+func (c *AuthController) completeLogin(ctx *gin.Context, user *models.User, loginName, deviceName string) {
+	cfg := ctx.MustGet("config").(*config.Config)
+	if cfg.Auth.RequireEmailVerification && user.Status == models.UserStatusPendingVerification {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "邮箱未验证"})
 		return
 	}
 
-	// 验证密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误"})
+	if user.TOTPEnabled {
+		challenge, err := c.twoFactorService.CreateChallenge(user.ID, loginName, deviceName, cfg)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "token生成失败"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
 		return
 	}
 
-	// 生成JWT token
+	c.issueLoginTokens(ctx, user, loginName, deviceName)
+}
+
+// issueLoginTokens 登录完成后创建会话并签发JWT，同时清除该用户名的登录失败计数
+func (c *AuthController) issueLoginTokens(ctx *gin.Context, user *models.User, loginName, deviceName string) {
 	cfg := ctx.MustGet("config").(*config.Config)
-	token, err := middleware.GenerateToken(user.ID, &cfg.JWT)
+	tokens, err := c.authService.IssueTokens(user.ID, sessionInfo(ctx, deviceName), &cfg.JWT)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "token生成失败"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"user":  user,
-		"token": token,
-	})
+	if err := c.loginGuardService.RecordSuccess(loginName); err != nil {
+		log.Printf("清除登录失败次数失败: %v", err)
+	}
+	ctx.JSON(http.StatusOK, tokenResponse(user, tokens))
+}
+
+// 两步验证登录的第二步：校验验证码或恢复码后签发JWT
+func (c *AuthController) LoginTwoFactor(ctx *gin.Context) {
+	var req LoginTwoFactorRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	challenge, err := c.twoFactorService.ParseChallenge(req.ChallengeToken, cfg)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 验证码错误与密码错误共用失败计数，锁定期间已签发的挑战token也不能继续尝试
+	ip, userAgent := ctx.ClientIP(), ctx.Request.UserAgent()
+	if !c.checkLoginGuard(ctx, challenge.LoginName, ip, userAgent) {
+		return
+	}
+
+	user, err := c.twoFactorService.CompleteChallenge(challenge, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTwoFactorCode):
+			if err := c.loginGuardService.RecordFailure(challenge.LoginName, ip, userAgent, service.LoginFailureInvalidTwoFactor, &cfg.Auth); err != nil {
+				log.Printf("记录登录失败次数失败: %v", err)
+			}
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrChallengeInvalid):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "两步验证失败"})
+		}
+		return
+	}
+
+	c.issueLoginTokens(ctx, user, challenge.LoginName, challenge.DeviceName)
+}
+
+// 使用刷新token换取新的token对
+func (c *AuthController) Refresh(ctx *gin.Context) {
+	var req RefreshRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	tokens, err := c.authService.RefreshTokens(req.RefreshToken, &cfg.JWT)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRefreshTokenReused):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "刷新token已被使用，请重新登录"})
+		case errors.Is(err, service.ErrRefreshTokenInvalid):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "无效的刷新token"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "token刷新失败"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// 登出：吊销当前会话及其所有token，传入刷新token时同时吊销它所在的家族
+func (c *AuthController) Logout(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	sessionID := ctx.GetUint("session_id")
+	cfg := ctx.MustGet("config").(*config.Config)
+
+	var req LogoutRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.RefreshToken != "" {
+		familySessionID, err := c.authService.RevokeRefreshToken(userID, req.RefreshToken, &cfg.JWT)
+		if err != nil && !errors.Is(err, service.ErrRefreshTokenInvalid) {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
+			return
+		}
+		if err == nil && familySessionID != sessionID {
+			websocket.DisconnectSessions(familySessionID)
+		}
+	}
+
+	if sessionID != 0 {
+		err := c.authService.RevokeSession(userID, sessionID, &cfg.JWT)
+		if err != nil && !errors.Is(err, service.ErrSessionNotFound) {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
+			return
+		}
+		websocket.DisconnectSessions(sessionID)
+	}
+
+	expiresAt := ctx.GetTime("token_expires_at")
+	if err := cache.RevokeToken(ctx.Request.Context(), ctx.GetString("token_id"), time.Until(expiresAt)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "已登出"})
+}
+
+// 忘记密码：向邮箱发送重置链接，无论邮箱是否存在都返回成功
+func (c *AuthController) ForgotPassword(ctx *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	if err := c.passwordService.RequestPasswordReset(req.Email, cfg); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "重置请求处理失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "如果该邮箱已注册，重置链接将发送到该邮箱"})
+}
+
+// 使用邮件中的token重置密码
+func (c *AuthController) ResetPassword(ctx *gin.Context) {
+	var req ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	revoked, err := c.passwordService.ResetPassword(req.Token, req.NewPassword, cfg)
+	if err != nil {
+		var policyErr *service.PasswordPolicyError
+		switch {
+		case errors.As(err, &policyErr), errors.Is(err, service.ErrPasswordTooLong),
+			errors.Is(err, service.ErrResetTokenInvalid):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "密码重置失败"})
+		}
+		return
+	}
+
+	websocket.DisconnectSessions(revoked...)
+	ctx.JSON(http.StatusOK, gin.H{"message": "密码已重置，请重新登录"})
+}
+
+// 验证邮箱
+func (c *AuthController) VerifyEmail(ctx *gin.Context) {
+	var req VerifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	user, err := c.verificationService.VerifyEmail(req.Token, cfg)
+	if err != nil {
+		if errors.Is(err, service.ErrVerifyTokenInvalid) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrEmailInUse) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "邮箱验证失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "邮箱验证成功", "user": newUserProfile(user)})
+}
+
+// 重新发送验证邮件
+func (c *AuthController) ResendVerification(ctx *gin.Context) {
+	var req ResendVerificationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	if err := c.verificationService.ResendVerification(req.Email, cfg); err != nil {
+		if errors.Is(err, service.ErrVerifyThrottled) {
+			ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "验证邮件发送失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "如果该邮箱待验证，验证邮件将重新发送"})
+}
+
+// tokenResponse 登录成功后的响应内容
+func tokenResponse(user *models.User, tokens *service.TokenPair) gin.H {
+	return gin.H{
+		"user":          newUserProfile(user),
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"session_id":    tokens.SessionID,
+	}
+}
+
+// sessionInfo 从请求中提取会话的客户端信息
+func sessionInfo(ctx *gin.Context, deviceName string) service.SessionInfo {
+	return service.SessionInfo{
+		DeviceName: deviceName,
+		UserAgent:  ctx.Request.UserAgent(),
+		IP:         ctx.ClientIP(),
+	}
+}
+
+// 本人资料，额外返回不向其他用户公开的角色、两步验证状态、隐私设置和待验证的新邮箱
+type userProfile struct {
+	*models.User
+	Role             string `json:"role"`
+	TOTPEnabled      bool   `json:"totp_enabled"`
+	PendingEmail     string `json:"pending_email,omitempty"`
+	HideReadReceipts bool   `json:"hide_read_receipts"`
+}
+
+func newUserProfile(user *models.User) userProfile {
+	return userProfile{
+		User:             user,
+		Role:             user.Role,
+		TOTPEnabled:      user.TOTPEnabled,
+		PendingEmail:     user.PendingEmail,
+		HideReadReceipts: user.HideReadReceipts,
+	}
 }
 
 // 用户相关接口
@@ -163,7 +582,7 @@ func (c *UserController) GetProfile(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"user": user})
+	ctx.JSON(http.StatusOK, gin.H{"user": newUserProfile(user)})
 }
 
 func (c *UserController) UpdateProfile(ctx *gin.Context) {
@@ -188,8 +607,22 @@ func (c *UserController) UpdateProfile(ctx *gin.Context) {
 	if req.Avatar != "" {
 		user.Avatar = req.Avatar
 	}
-	if req.Email != "" {
-		user.Email = req.Email
+	// 新邮箱验证通过后才替换原邮箱，在此之前原邮箱仍用于登录和找回密码
+	cfg := ctx.MustGet("config").(*config.Config)
+	emailChanged := req.Email != "" && req.Email != user.Email
+	if emailChanged {
+		if err := c.verificationService.ReleaseEmail(req.Email, userID, cfg); err != nil {
+			if errors.Is(err, service.ErrEmailInUse) {
+				ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "用户更新失败"})
+			return
+		}
+		user.PendingEmail = req.Email
+	} else if req.Email == user.Email {
+		// 改回原邮箱时取消待验证的修改
+		user.PendingEmail = ""
 	}
 
 	if err := c.userService.UpdateUser(user); err != nil {
@@ -197,7 +630,65 @@ func (c *UserController) UpdateProfile(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"user": user})
+	if emailChanged {
+		if err := c.verificationService.SendVerificationEmail(user, user.PendingEmail, cfg); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "验证邮件发送失败"})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"user": newUserProfile(user)})
+}
+
+// 隐私设置请求结构
+type UpdatePrivacyRequest struct {
+	HideReadReceipts *bool `json:"hide_read_receipts" binding:"required"`
+}
+
+// 修改隐私设置，关闭已读回执后其他成员看不到自己的已读和送达状态
+func (c *UserController) UpdatePrivacy(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	var req UpdatePrivacyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.userService.SetHideReadReceipts(userID, *req.HideReadReceipts); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "隐私设置更新失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"hide_read_receipts": *req.HideReadReceipts})
+}
+
+// 修改密码，成功后其他设备上的会话全部失效
+func (c *UserController) ChangePassword(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	var req ChangePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	revoked, err := c.passwordService.ChangePassword(userID, ctx.GetUint("session_id"), req.OldPassword, req.NewPassword, cfg)
+	if err != nil {
+		var policyErr *service.PasswordPolicyError
+		switch {
+		case errors.Is(err, service.ErrWrongPassword):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.As(err, &policyErr), errors.Is(err, service.ErrPasswordTooLong),
+			errors.Is(err, service.ErrPasswordUnchanged):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "密码修改失败"})
+		}
+		return
+	}
+
+	websocket.DisconnectSessions(revoked...)
+	ctx.JSON(http.StatusOK, gin.H{"message": "密码修改成功"})
 }
 
 // 搜索用户
@@ -268,32 +759,61 @@ func (c *ChatController) CreateRoom(ctx *gin.Context) {
 		return
 	}
 
+	if req.Type == "single" {
+		// 单聊与 POST /dms/:userId 相同，两人之间只有一个单聊
+		if len(req.MemberIDs) != 1 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "单聊只能指定一个成员"})
+			return
+		}
+		c.openDM(ctx, userID, req.MemberIDs[0])
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	if len(req.MemberIDs) > cfg.Room.MaxInitialMembers {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("创建时最多指定%d个成员", cfg.Room.MaxInitialMembers)})
+		return
+	}
+	if req.MaxMembers == 0 {
+		req.MaxMembers = cfg.Room.DefaultMaxMembers
+	}
+	if req.MaxMembers > cfg.Room.MaxMembersLimit {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("人数上限不能超过%d", cfg.Room.MaxMembersLimit)})
+		return
+	}
+
 	room := &models.ChatRoom{
 		Name:        req.Name,
 		Description: req.Description,
 		Type:        req.Type,
 		OwnerID:     userID,
-		MaxMembers:  100,
+		MaxMembers:  req.MaxMembers,
+
+		OnlyAdminsPost:   req.OnlyAdminsPost,
+		OnlyAdminsInvite: req.OnlyAdminsInvite,
+		Visibility:       req.Visibility,
+	}
+	if room.Visibility == "" {
+		room.Visibility = models.RoomVisibilityInviteOnly
 	}
 
-	if req.Type == "single" && len(req.MemberIDs) == 1 {
-		// 单聊，将对方也加入成员列表
-		req.MemberIDs = append(req.MemberIDs, userID)
-	} else {
-		// 群聊，确保房主在成员列表中
-		hasOwner := false
-		for _, id := range req.MemberIDs {
-			if id == userID {
-				hasOwner = true
-				break
-			}
-		}
-		if !hasOwner {
-			req.MemberIDs = append(req.MemberIDs, userID)
+	// 群聊，确保房主在成员列表中
+	hasOwner := false
+	for _, id := range req.MemberIDs {
+		if id == userID {
+			hasOwner = true
+			break
 		}
 	}
+	if !hasOwner {
+		req.MemberIDs = append(req.MemberIDs, userID)
+	}
 
 	if err := c.chatService.CreateRoom(room, req.MemberIDs); err != nil {
+		if errors.Is(err, service.ErrRoomFull) {
+			respondRoomFull(ctx)
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "房间创建失败"})
 		return
 	}
@@ -307,31 +827,222 @@ func (c *ChatController) CreateRoom(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, gin.H{"room": room})
 }
 
-func (c *ChatController) GetRoom(ctx *gin.Context) {
-	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+// OpenDM 打开与指定用户的单聊，已存在时返回原来的房间
+func (c *ChatController) OpenDM(ctx *gin.Context) {
+	otherID, err := strconv.ParseUint(ctx.Param("userId"), 10, 32)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	c.openDM(ctx, ctx.GetUint("user_id"), uint(otherID))
+}
+
+func (c *ChatController) openDM(ctx *gin.Context, userID, otherID uint) {
+	room, created, err := c.chatService.GetOrCreateDM(userID, otherID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrCannotTargetSelf):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "不能和自己单聊"})
+		case errors.Is(err, service.ErrDMUserNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			log.Printf("打开单聊失败: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "打开单聊失败"})
+		}
 		return
 	}
 
-	room, err := c.chatService.GetRoomByID(uint(roomID))
+	room, err = c.chatService.GetRoomByID(room.ID)
+	if err == nil {
+		err = c.chatService.ResolveDMNames(userID, room)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取房间信息失败"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	ctx.JSON(status, gin.H{"room": room, "created": created})
+}
+
+func (c *ChatController) GetRoom(ctx *gin.Context) {
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrNotRoomMember.Error()})
+		return
+	}
+
+	room, err := c.chatService.GetRoomByID(access.Room.ID)
 	if err != nil {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "房间不存在"})
 		return
 	}
+	if err := c.chatService.ResolveDMNames(ctx.GetUint("user_id"), room); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取房间信息失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"room": room})
+}
+
+func (c *ChatController) UpdateRoom(ctx *gin.Context) {
+	var req UpdateRoomRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanEditRoom() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有修改房间的权限"})
+		return
+	}
+	if access.IsArchived() {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "房间已归档，请先取消归档"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.Avatar != nil {
+		updates["avatar"] = *req.Avatar
+	}
+	if req.MaxMembers != nil {
+		cfg := ctx.MustGet("config").(*config.Config)
+		if *req.MaxMembers > cfg.Room.MaxMembersLimit {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("人数上限不能超过%d", cfg.Room.MaxMembersLimit)})
+			return
+		}
+		updates["max_members"] = *req.MaxMembers
+	}
+	if req.OnlyAdminsPost != nil {
+		updates["only_admins_post"] = *req.OnlyAdminsPost
+	}
+	if req.OnlyAdminsInvite != nil {
+		updates["only_admins_invite"] = *req.OnlyAdminsInvite
+	}
+	if req.Visibility != nil {
+		updates["visibility"] = *req.Visibility
+	}
+	if len(updates) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "没有需要修改的内容"})
+		return
+	}
+
+	room, err := c.chatService.UpdateRoom(access.Room.ID, updates)
+	if err != nil {
+		if errors.Is(err, service.ErrMaxMembersTooSmall) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "修改房间失败"})
+		return
+	}
 
+	websocket.BroadcastRoomEvent(room.ID, "room_updated", room)
 	ctx.JSON(http.StatusOK, gin.H{"room": room})
 }
 
+// ArchiveRoom 归档房间，归档后不能发送消息和邀请成员，历史消息仍可查看
+func (c *ChatController) ArchiveRoom(ctx *gin.Context) {
+	c.setArchived(ctx, true)
+}
+
+// UnarchiveRoom 取消归档
+func (c *ChatController) UnarchiveRoom(ctx *gin.Context) {
+	c.setArchived(ctx, false)
+}
+
+func (c *ChatController) setArchived(ctx *gin.Context, archived bool) {
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanEditRoom() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有归档房间的权限"})
+		return
+	}
+
+	room, err := c.chatService.SetArchived(access.Room.ID, archived)
+	if err != nil {
+		if errors.Is(err, service.ErrRoomArchived) || errors.Is(err, service.ErrRoomNotArchived) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "修改归档状态失败"})
+		return
+	}
+
+	websocket.BroadcastRoomEvent(room.ID, "room_updated", room)
+	ctx.JSON(http.StatusOK, gin.H{"room": room})
+}
+
+// DeleteRoom 删除群聊，房间内的所有连接都会被移出
+func (c *ChatController) DeleteRoom(ctx *gin.Context) {
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanDeleteRoom() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有群主可以删除群聊"})
+		return
+	}
+
+	if err := c.chatService.DeleteRoom(access.Room.ID); err != nil {
+		if errors.Is(err, service.ErrRoomNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "删除房间失败"})
+		return
+	}
+
+	websocket.CloseRoom(access.Room.ID, "room_deleted", gin.H{
+		"room_id":     access.Room.ID,
+		"operator_id": ctx.GetUint("user_id"),
+	})
+	ctx.JSON(http.StatusOK, gin.H{"message": "房间已删除"})
+}
+
 func (c *ChatController) JoinRoom(ctx *gin.Context) {
 	userID := ctx.GetUint("user_id")
-	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanJoin() {
+		if access.CanRequestJoin() {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "该房间需要申请加入"})
+			return
+		}
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "该房间需要邀请才能加入"})
 		return
 	}
 
-	if err := c.chatService.JoinRoom(userID, uint(roomID)); err != nil {
+	if err := c.chatService.JoinRoom(userID, access.Room.ID); err != nil {
+		if errors.Is(err, service.ErrUserBanned) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrRoomFull) {
+			respondRoomFull(ctx)
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "加入房间失败"})
 		return
 	}
@@ -341,13 +1052,20 @@ func (c *ChatController) JoinRoom(ctx *gin.Context) {
 
 func (c *ChatController) LeaveRoom(ctx *gin.Context) {
 	userID := ctx.GetUint("user_id")
-	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.IsMember() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrNotRoomMember.Error()})
+		return
+	}
+	if !access.CanLeave() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "群主需要先转让群主身份才能离开群聊"})
 		return
 	}
 
-	if err := c.chatService.LeaveRoom(userID, uint(roomID)); err != nil {
+	if err := c.chatService.LeaveRoom(userID, access.Room.ID); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "离开房间失败"})
 		return
 	}
@@ -356,9 +1074,12 @@ func (c *ChatController) LeaveRoom(ctx *gin.Context) {
 }
 
 func (c *ChatController) GetMessages(ctx *gin.Context) {
-	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrNotRoomMember.Error()})
 		return
 	}
 
@@ -372,7 +1093,7 @@ func (c *ChatController) GetMessages(ctx *gin.Context) {
 		pageSize = 20
 	}
 
-	messages, err := c.messageService.GetRoomMessages(uint(roomID), page, pageSize)
+	messages, err := c.messageService.GetRoomMessages(access.Room.ID, ctx.GetUint("user_id"), page, pageSize)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息列表失败"})
 		return
@@ -387,45 +1108,63 @@ func (c *ChatController) GetMessages(ctx *gin.Context) {
 
 func (c *ChatController) MarkAsRead(ctx *gin.Context) {
 	userID := ctx.GetUint("user_id")
-	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrNotRoomMember.Error()})
 		return
 	}
 
-	if err := c.messageService.MarkAsRead(userID, uint(roomID)); err != nil {
+	receipt, err := c.messageService.MarkAsRead(userID, access.Room.ID)
+	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "标记已读失败"})
 		return
 	}
+	if receipt != nil {
+		websocket.PublishReadReceipt(receipt)
+	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "标记成功"})
 }
 
 func (c *ChatController) GetUnreadCount(ctx *gin.Context) {
 	userID := ctx.GetUint("user_id")
-	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrNotRoomMember.Error()})
 		return
 	}
 
-	count, err := c.messageService.GetUnreadCount(userID, uint(roomID))
+	count, err := c.messageService.GetUnreadCount(userID, access.Room.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取未读数失败"})
+		return
+	}
+	mentionCount, err := c.messageService.GetMentionCount(userID, access.Room.ID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取未读数失败"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"unread_count": count})
+	ctx.JSON(http.StatusOK, gin.H{"unread_count": count, "mention_count": mentionCount})
 }
 
 func (c *ChatController) GetRoomMembers(ctx *gin.Context) {
-	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrNotRoomMember.Error()})
 		return
 	}
 
-	members, err := c.chatService.GetRoomMembers(uint(roomID))
+	members, err := c.chatService.GetRoomMembers(access.Room.ID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取成员列表失败"})
 		return
@@ -440,36 +1179,71 @@ type AddMemberRequest struct {
 }
 
 func (c *ChatController) AddMember(ctx *gin.Context) {
-	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
-		return
-	}
-
 	var req AddMemberRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 检查房间是否存在
-	room, err := c.chatService.GetRoomByID(uint(roomID))
-	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "房间不存在"})
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
 		return
 	}
 
 	// 只有群聊才能添加成员
-	if room.Type != "group" {
+	if access.Room.Type != "group" {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "只有群聊才能添加成员"})
 		return
 	}
+	if !access.CanInvite() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有邀请成员的权限"})
+		return
+	}
 
 	// 添加成员
-	if err := c.chatService.JoinRoom(req.UserID, uint(roomID)); err != nil {
+	if err := c.chatService.JoinRoom(req.UserID, access.Room.ID); err != nil {
+		if errors.Is(err, service.ErrUserBanned) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "该用户已被禁止加入房间"})
+			return
+		}
+		if errors.Is(err, service.ErrRoomFull) {
+			respondRoomFull(ctx)
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "添加成员失败"})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "成员添加成功"})
 }
+
+// ErrorCodeRoomFull 房间人数已满时响应中的code，客户端据此与其他冲突错误区分
+const ErrorCodeRoomFull = "room_full"
+
+func respondRoomFull(ctx *gin.Context) {
+	ctx.JSON(http.StatusConflict, gin.H{"error": service.ErrRoomFull.Error(), "code": ErrorCodeRoomFull})
+}
+
+// loadRoomAccess 解析路由中的房间ID并加载当前用户在该房间的权限，失败时已写入错误响应
+func loadRoomAccess(ctx *gin.Context) (*service.RoomAccess, bool) {
+	roomID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+		return nil, false
+	}
+	return getRoomAccess(ctx, uint(roomID))
+}
+
+// getRoomAccess 获取当前用户在指定房间的权限，失败时已写入响应
+func getRoomAccess(ctx *gin.Context, roomID uint) (*service.RoomAccess, bool) {
+	access, err := service.GetRoomAccess(ctx.GetUint("user_id"), roomID)
+	if err != nil {
+		if errors.Is(err, service.ErrRoomNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "房间不存在"})
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取房间信息失败"})
+		return nil, false
+	}
+	return access, true
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"chat-service/internal/models"
+	"chat-service/internal/service"
+	"chat-service/internal/websocket"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InviteController struct {
+	inviteService *service.InviteService
+	chatService   *service.ChatService
+}
+
+func NewInviteController() *InviteController {
+	return &InviteController{
+		inviteService: service.NewInviteService(),
+		chatService:   service.NewChatService(),
+	}
+}
+
+// 创建邀请码请求结构，MaxUses和ExpiresInHours为0表示不限制
+type CreateInviteRequest struct {
+	Role           string `json:"role" binding:"omitempty,oneof=admin member"`
+	MaxUses        int    `json:"max_uses" binding:"min=0,max=10000"`
+	ExpiresInHours int    `json:"expires_in_hours" binding:"min=0,max=8760"`
+}
+
+// 创建邀请码
+func (c *InviteController) CreateInvite(ctx *gin.Context) {
+	var req CreateInviteRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoomRoleMember
+	}
+
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanManageInvites() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有创建邀请码的权限"})
+		return
+	}
+	// 只有群主可以设置管理员，邀请为管理员同理
+	if req.Role == models.RoomRoleAdmin && access.Role() != models.RoomRoleOwner {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有群主可以创建管理员邀请码"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	invite, err := c.inviteService.CreateInvite(access.Room.ID, ctx.GetUint("user_id"), req.Role, req.MaxUses, expiresAt)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建邀请码失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"invite": invite})
+}
+
+// 获取房间有效的邀请码
+func (c *InviteController) GetInvites(ctx *gin.Context) {
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanManageInvites() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrPermissionDenied.Error()})
+		return
+	}
+
+	invites, err := c.inviteService.GetInvites(access.Room.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请码失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"invites": invites})
+}
+
+// 吊销邀请码
+func (c *InviteController) RevokeInvite(ctx *gin.Context) {
+	inviteID, err := strconv.ParseUint(ctx.Param("inviteId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的邀请码ID"})
+		return
+	}
+
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.IsAdmin() || access.Room.Type != "group" {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有吊销邀请码的权限"})
+		return
+	}
+
+	if err := c.inviteService.RevokeInvite(access.Room.ID, uint(inviteID)); err != nil {
+		if errors.Is(err, service.ErrInviteNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销邀请码失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "邀请码已吊销"})
+}
+
+// 预览邀请码对应的房间，不需要登录
+func (c *InviteController) PreviewInvite(ctx *gin.Context) {
+	preview, err := c.inviteService.GetPreview(ctx.Param("code"))
+	if err != nil {
+		c.handleError(ctx, err, "获取邀请信息失败")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"invite": preview})
+}
+
+// 使用邀请码加入房间
+func (c *InviteController) RedeemInvite(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+
+	room, msg, err := c.inviteService.RedeemInvite(ctx.Param("code"), userID)
+	if err != nil {
+		c.handleError(ctx, err, "加入房间失败")
+		return
+	}
+
+	if msg != nil {
+		websocket.BroadcastSystemMessage(msg)
+		websocket.BroadcastRoomEvent(room.ID, "member_joined", gin.H{"user_id": userID})
+	}
+
+	room, err = c.chatService.GetRoomByID(room.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取房间信息失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"room": room})
+}
+
+func (c *InviteController) handleError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInviteNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInviteExpired), errors.Is(err, service.ErrInviteExhausted):
+		ctx.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrUserBanned):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoomFull):
+		respondRoomFull(ctx)
+	case errors.Is(err, service.ErrRoomArchived):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
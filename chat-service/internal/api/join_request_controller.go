@@ -0,0 +1,222 @@
+package api
+
+import (
+	"chat-service/internal/models"
+	"chat-service/internal/service"
+	"chat-service/internal/websocket"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JoinRequestController struct {
+	joinRequestService *service.JoinRequestService
+}
+
+func NewJoinRequestController() *JoinRequestController {
+	return &JoinRequestController{
+		joinRequestService: service.NewJoinRequestService(),
+	}
+}
+
+// 加入申请请求结构
+type CreateJoinRequestRequest struct {
+	Message string `json:"message" binding:"max=255"`
+}
+
+// 公开房间目录，支持按名称和描述搜索
+func (c *JoinRequestController) GetPublicRooms(ctx *gin.Context) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	rooms, total, err := c.joinRequestService.GetPublicRooms(ctx.Query("q"), page, pageSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取公开房间失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"rooms":     rooms,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 提交加入申请
+func (c *JoinRequestController) CreateRequest(ctx *gin.Context) {
+	var req CreateJoinRequestRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if access.IsMember() {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "你已经是该房间的成员"})
+		return
+	}
+	if !access.CanRequestJoin() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "该房间不接受加入申请"})
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	request, err := c.joinRequestService.CreateRequest(access.Room.ID, userID, req.Message)
+	if err != nil {
+		c.handleError(ctx, err, "提交申请失败")
+		return
+	}
+
+	// 通知群主和管理员有新的申请
+	reviewerIDs, err := c.joinRequestService.GetReviewerIDs(access.Room.ID)
+	if err != nil {
+		log.Printf("获取房间管理员失败: %v", err)
+	}
+	for _, reviewerID := range reviewerIDs {
+		websocket.SendToUser(reviewerID, websocket.WSMessage{
+			Type:     "join_request_created",
+			RoomID:   access.Room.ID,
+			SenderID: userID,
+			Content:  request,
+		})
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"request": request})
+}
+
+// 获取房间的加入申请，默认只返回待审核的申请
+func (c *JoinRequestController) GetRequests(ctx *gin.Context) {
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanReviewJoinRequests() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrPermissionDenied.Error()})
+		return
+	}
+
+	status := ctx.DefaultQuery("status", models.JoinRequestPending)
+	if status == "all" {
+		status = ""
+	}
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	requests, err := c.joinRequestService.GetRequests(access.Room.ID, status, page, pageSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取加入申请失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"requests":  requests,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 同意加入申请
+func (c *JoinRequestController) ApproveRequest(ctx *gin.Context) {
+	access, requestID, ok := c.loadReview(ctx)
+	if !ok {
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	request, msg, err := c.joinRequestService.ApproveRequest(access.Room.ID, requestID, userID)
+	if err != nil {
+		c.handleError(ctx, err, "同意申请失败")
+		return
+	}
+
+	if msg != nil {
+		websocket.BroadcastSystemMessage(msg)
+		websocket.BroadcastRoomEvent(access.Room.ID, "member_joined", gin.H{"user_id": request.UserID})
+	}
+	websocket.SendToUser(request.UserID, websocket.WSMessage{
+		Type:     "join_request_approved",
+		RoomID:   access.Room.ID,
+		SenderID: userID,
+		Content:  request,
+	})
+	ctx.JSON(http.StatusOK, gin.H{"request": request})
+}
+
+// 拒绝加入申请
+func (c *JoinRequestController) RejectRequest(ctx *gin.Context) {
+	access, requestID, ok := c.loadReview(ctx)
+	if !ok {
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	request, err := c.joinRequestService.RejectRequest(access.Room.ID, requestID, userID)
+	if err != nil {
+		c.handleError(ctx, err, "拒绝申请失败")
+		return
+	}
+
+	websocket.SendToUser(request.UserID, websocket.WSMessage{
+		Type:     "join_request_rejected",
+		RoomID:   access.Room.ID,
+		SenderID: userID,
+		Content:  request,
+	})
+	ctx.JSON(http.StatusOK, gin.H{"request": request})
+}
+
+// loadReview 解析申请ID并校验审核权限，失败时已写入响应
+func (c *JoinRequestController) loadReview(ctx *gin.Context) (*service.RoomAccess, uint, bool) {
+	requestID, err := strconv.ParseUint(ctx.Param("requestId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的申请ID"})
+		return nil, 0, false
+	}
+
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return nil, 0, false
+	}
+	if !access.CanReviewJoinRequests() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有审核加入申请的权限"})
+		return nil, 0, false
+	}
+	return access, uint(requestID), true
+}
+
+func (c *JoinRequestController) handleError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrJoinRequestNotFound), errors.Is(err, service.ErrRoomNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrJoinRequestPending), errors.Is(err, service.ErrRoomArchived):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoomFull):
+		respondRoomFull(ctx)
+	case errors.Is(err, service.ErrUserBanned):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"chat-service/internal/models"
+	"chat-service/internal/service"
+	"chat-service/internal/websocket"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MemberController struct {
+	memberService *service.MemberService
+}
+
+func NewMemberController() *MemberController {
+	return &MemberController{
+		memberService: service.NewMemberService(),
+	}
+}
+
+// 修改成员角色请求结构
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin member"`
+}
+
+// 封禁成员请求结构
+type BanMemberRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// 设置或取消管理员
+func (c *MemberController) ChangeRole(ctx *gin.Context) {
+	var req ChangeRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	access, target, ok := c.loadTarget(ctx)
+	if !ok {
+		return
+	}
+	if target.member == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMemberNotFound.Error()})
+		return
+	}
+	if !access.CanChangeRole(target.member) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有群主可以设置管理员"})
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	msg, err := c.memberService.ChangeRole(access.Room.ID, userID, target.userID, req.Role)
+	if err != nil {
+		c.handleError(ctx, err, "修改角色失败")
+		return
+	}
+
+	websocket.BroadcastSystemMessage(msg)
+	websocket.BroadcastRoomEvent(access.Room.ID, "member_role_changed", gin.H{
+		"user_id":     target.userID,
+		"role":        req.Role,
+		"operator_id": userID,
+	})
+	ctx.JSON(http.StatusOK, gin.H{"message": "角色已更新"})
+}
+
+// 将成员移出群聊
+func (c *MemberController) KickMember(ctx *gin.Context) {
+	access, target, ok := c.loadTarget(ctx)
+	if !ok {
+		return
+	}
+	if target.member == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMemberNotFound.Error()})
+		return
+	}
+	if !access.CanKick(target.member) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有移除该成员的权限"})
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	msg, err := c.memberService.RemoveMember(access.Room.ID, userID, target.userID)
+	if err != nil {
+		c.handleError(ctx, err, "移除成员失败")
+		return
+	}
+
+	websocket.BroadcastSystemMessage(msg)
+	websocket.BroadcastRoomEvent(access.Room.ID, "member_removed", gin.H{
+		"user_id":     target.userID,
+		"operator_id": userID,
+	})
+	websocket.RemoveUserFromRoom(access.Room.ID, target.userID, "kicked", gin.H{"operator_id": userID})
+	ctx.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
+}
+
+// 封禁用户，被封禁的用户会被移出并且不能再加入
+func (c *MemberController) BanMember(ctx *gin.Context) {
+	var req BanMemberRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	access, target, ok := c.loadTarget(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanBan(target.member) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有封禁该用户的权限"})
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	msg, err := c.memberService.BanMember(access.Room.ID, userID, target.userID, req.Reason)
+	if err != nil {
+		c.handleError(ctx, err, "封禁失败")
+		return
+	}
+
+	websocket.BroadcastSystemMessage(msg)
+	websocket.BroadcastRoomEvent(access.Room.ID, "member_banned", gin.H{
+		"user_id":     target.userID,
+		"operator_id": userID,
+	})
+	websocket.RemoveUserFromRoom(access.Room.ID, target.userID, "banned", gin.H{
+		"operator_id": userID,
+		"reason":      req.Reason,
+	})
+	ctx.JSON(http.StatusOK, gin.H{"message": "用户已封禁"})
+}
+
+// 解除封禁
+func (c *MemberController) UnbanMember(ctx *gin.Context) {
+	access, target, ok := c.loadTarget(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanBan(nil) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有解除封禁的权限"})
+		return
+	}
+
+	if err := c.memberService.UnbanMember(access.Room.ID, target.userID); err != nil {
+		c.handleError(ctx, err, "解除封禁失败")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "已解除封禁"})
+}
+
+// 获取房间的封禁列表
+func (c *MemberController) GetBans(ctx *gin.Context) {
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanBan(nil) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrPermissionDenied.Error()})
+		return
+	}
+
+	bans, err := c.memberService.GetBans(access.Room.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取封禁列表失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"bans": bans})
+}
+
+// 转让群主
+func (c *MemberController) TransferOwnership(ctx *gin.Context) {
+	access, target, ok := c.loadTarget(ctx)
+	if !ok {
+		return
+	}
+	if !access.CanTransferOwnership() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "只有群主可以转让群聊"})
+		return
+	}
+	if target.member == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMemberNotFound.Error()})
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	msg, err := c.memberService.TransferOwnership(access.Room.ID, userID, target.userID)
+	if err != nil {
+		c.handleError(ctx, err, "转让群主失败")
+		return
+	}
+
+	websocket.BroadcastSystemMessage(msg)
+	websocket.BroadcastRoomEvent(access.Room.ID, "owner_transferred", gin.H{
+		"from_user_id": userID,
+		"to_user_id":   target.userID,
+	})
+	ctx.JSON(http.StatusOK, gin.H{"message": "群主已转让"})
+}
+
+// memberTarget 路由中:userId指定的目标用户，member为nil表示不是房间成员
+type memberTarget struct {
+	userID uint
+	member *models.RoomMember
+}
+
+// loadTarget 加载当前用户的房间权限和目标用户的成员记录，失败时已写入响应
+func (c *MemberController) loadTarget(ctx *gin.Context) (*service.RoomAccess, *memberTarget, bool) {
+	targetID, err := strconv.ParseUint(ctx.Param("userId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return nil, nil, false
+	}
+	if uint(targetID) == ctx.GetUint("user_id") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": service.ErrCannotTargetSelf.Error()})
+		return nil, nil, false
+	}
+
+	access, ok := loadRoomAccess(ctx)
+	if !ok {
+		return nil, nil, false
+	}
+	if !access.IsMember() {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": service.ErrNotRoomMember.Error()})
+		return nil, nil, false
+	}
+
+	member, err := c.memberService.GetMember(access.Room.ID, uint(targetID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取成员信息失败"})
+		return nil, nil, false
+	}
+	return access, &memberTarget{userID: uint(targetID), member: member}, true
+}
+
+func (c *MemberController) handleError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrMemberNotFound), errors.Is(err, service.ErrBanNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrRoleUnchanged),
+		errors.Is(err, service.ErrCannotTargetSelf):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrPermissionDenied):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
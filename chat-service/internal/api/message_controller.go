@@ -0,0 +1,347 @@
+package api
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/models"
+	"chat-service/internal/service"
+	"chat-service/internal/websocket"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MessageController struct {
+	messageService *service.MessageService
+}
+
+func NewMessageController() *MessageController {
+	return &MessageController{
+		messageService: service.NewMessageService(),
+	}
+}
+
+// 编辑消息请求结构
+type EditMessageRequest struct {
+	Content string `json:"content" binding:"required,max=1000"`
+}
+
+// 表情回应请求结构
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// 发送消息，与WebSocket的message操作相同，会广播到房间
+func (c *MessageController) SendMessage(ctx *gin.Context) {
+	var req SendMessageRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	access, ok := getRoomAccess(ctx, req.RoomID)
+	if !ok {
+		return
+	}
+	if !access.CanPostMessage() {
+		if access.IsArchived() {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "房间已归档，不能发送消息"})
+			return
+		}
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有在该房间发言的权限"})
+		return
+	}
+
+	msg := &models.Message{
+		RoomID:    access.Room.ID,
+		SenderID:  ctx.GetUint("user_id"),
+		Content:   req.Content,
+		Type:      req.Type,
+		ReplyToID: req.ReplyToID,
+	}
+	root, err := c.messageService.SendMessage(msg)
+	if err != nil {
+		c.handleError(ctx, err, "发送消息失败")
+		return
+	}
+
+	websocket.PublishMessage(msg, root)
+
+	msg, err = c.messageService.GetMessageByID(msg.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息失败"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"message": msg})
+}
+
+// 获取消息所在话题，返回话题的第一条消息和分页的回复
+func (c *MessageController) GetThread(ctx *gin.Context) {
+	messageID, ok := parseMessageID(ctx)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	root, err := c.messageService.GetThreadRoot(messageID)
+	if err != nil {
+		c.handleError(ctx, err, "获取话题失败")
+		return
+	}
+
+	// 不是成员时与消息不存在返回相同的结果，避免泄露其他房间的消息ID
+	access, ok := getRoomAccess(ctx, root.RoomID)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMessageNotFound.Error()})
+		return
+	}
+
+	replies, err := c.messageService.GetThreadReplies(root.ID, page, pageSize)
+	if err != nil {
+		c.handleError(ctx, err, "获取话题失败")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"root":      root,
+		"messages":  replies,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 编辑消息，只有发送者可以在配置的时间内编辑
+func (c *MessageController) EditMessage(ctx *gin.Context) {
+	messageID, ok := parseMessageID(ctx)
+	if !ok {
+		return
+	}
+
+	var req EditMessageRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	window := time.Duration(cfg.Message.EditWindowMinute) * time.Minute
+
+	msg, mentions, err := c.messageService.EditMessage(messageID, ctx.GetUint("user_id"), req.Content, window)
+	if err != nil {
+		c.handleError(ctx, err, "编辑消息失败")
+		return
+	}
+
+	websocket.PublishMessageEdited(msg, mentions)
+	ctx.JSON(http.StatusOK, gin.H{"message": msg})
+}
+
+// 获取消息的编辑历史，房间成员可见
+func (c *MessageController) GetEditHistory(ctx *gin.Context) {
+	messageID, ok := parseMessageID(ctx)
+	if !ok {
+		return
+	}
+
+	msg, err := c.messageService.GetMessageByID(messageID)
+	if err != nil || msg.IsDeleted {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMessageNotFound.Error()})
+		return
+	}
+	access, ok := getRoomAccess(ctx, msg.RoomID)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMessageNotFound.Error()})
+		return
+	}
+
+	edits, err := c.messageService.GetEditHistory(msg.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取编辑历史失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": msg, "edits": edits})
+}
+
+// 删除消息。scope=everyone（默认）为所有人删除，需要是发送者或群主、管理员；scope=me仅对自己隐藏
+func (c *MessageController) DeleteMessage(ctx *gin.Context) {
+	messageID, ok := parseMessageID(ctx)
+	if !ok {
+		return
+	}
+
+	scope := ctx.DefaultQuery("scope", "everyone")
+	if scope != "everyone" && scope != "me" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "scope只能为everyone或me"})
+		return
+	}
+
+	msg, err := c.messageService.GetMessageByID(messageID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMessageNotFound.Error()})
+		return
+	}
+	access, ok := getRoomAccess(ctx, msg.RoomID)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMessageNotFound.Error()})
+		return
+	}
+
+	userID := ctx.GetUint("user_id")
+	if scope == "me" {
+		if err := c.messageService.HideMessage(msg.ID, userID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "删除消息失败"})
+			return
+		}
+		// 同步到该用户的其他设备
+		websocket.SendToUser(userID, websocket.WSMessage{
+			Type:      "message_deleted",
+			RoomID:    msg.RoomID,
+			Content:   gin.H{"scope": "me"},
+			MessageID: msg.ID,
+		})
+		ctx.JSON(http.StatusOK, gin.H{"message": "消息已删除"})
+		return
+	}
+
+	if !access.CanDeleteMessage(msg) {
+		if access.IsArchived() {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "房间已归档，不能删除消息"})
+			return
+		}
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "没有删除该消息的权限"})
+		return
+	}
+
+	root, err := c.messageService.DeleteMessage(msg.ID)
+	if err != nil {
+		c.handleError(ctx, err, "删除消息失败")
+		return
+	}
+
+	websocket.PublishMessageDeleted(msg, root)
+	ctx.JSON(http.StatusOK, gin.H{"message": "消息已删除"})
+}
+
+// 添加表情回应
+func (c *MessageController) AddReaction(ctx *gin.Context) {
+	messageID, ok := parseMessageID(ctx)
+	if !ok {
+		return
+	}
+
+	var req ReactionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := c.messageService.AddReaction(messageID, ctx.GetUint("user_id"), req.Emoji)
+	if err != nil {
+		c.handleError(ctx, err, "添加表情回应失败")
+		return
+	}
+
+	websocket.PublishReaction("reaction_added", change)
+	ctx.JSON(http.StatusOK, gin.H{"reaction": change})
+}
+
+// 取消表情回应，表情在路径中需要URL编码
+func (c *MessageController) RemoveReaction(ctx *gin.Context) {
+	messageID, ok := parseMessageID(ctx)
+	if !ok {
+		return
+	}
+
+	change, err := c.messageService.RemoveReaction(messageID, ctx.GetUint("user_id"), ctx.Param("emoji"))
+	if err != nil {
+		c.handleError(ctx, err, "取消表情回应失败")
+		return
+	}
+
+	websocket.PublishReaction("reaction_removed", change)
+	ctx.JSON(http.StatusOK, gin.H{"reaction": change})
+}
+
+// 获取消息的已读和送达成员
+func (c *MessageController) GetReceipts(ctx *gin.Context) {
+	messageID, ok := parseMessageID(ctx)
+	if !ok {
+		return
+	}
+
+	msg, err := c.messageService.GetMessageByID(messageID)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMessageNotFound.Error()})
+		return
+	}
+	access, ok := getRoomAccess(ctx, msg.RoomID)
+	if !ok {
+		return
+	}
+	if !access.CanView() {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": service.ErrMessageNotFound.Error()})
+		return
+	}
+
+	readBy, deliveredTo, err := c.messageService.GetMessageReceipts(msg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息回执失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message_id":   msg.ID,
+		"read_by":      readBy,
+		"delivered_to": deliveredTo,
+	})
+}
+
+// parseMessageID 解析路由中的消息ID，失败时已写入响应
+func parseMessageID(ctx *gin.Context) (uint, bool) {
+	messageID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的消息ID"})
+		return 0, false
+	}
+	return uint(messageID), true
+}
+
+func (c *MessageController) handleError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrMessageNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrReplyTargetNotFound), errors.Is(err, service.ErrInvalidEmoji),
+		errors.Is(err, service.ErrMessageTooLong):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotMessageSender), errors.Is(err, service.ErrMessageNotEditable),
+		errors.Is(err, service.ErrPermissionDenied):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEditWindowExpired), errors.Is(err, service.ErrRoomArchived):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
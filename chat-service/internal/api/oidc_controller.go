@@ -0,0 +1,138 @@
+package api
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/service"
+	"chat-service/internal/websocket"
+	"chat-service/pkg/cache"
+	"chat-service/pkg/oidc"
+	"chat-service/pkg/utils"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+type OIDCController struct {
+	provider       *oidc.Provider
+	oidcService    *service.OIDCService
+	authController *AuthController
+}
+
+// oidcLoginState 跳转到IdP前保存的登录状态，回调时按state取出
+type oidcLoginState struct {
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	DeviceName   string `json:"device_name"`
+}
+
+func NewOIDCController(cfg *config.OIDCConfig, authController *AuthController) *OIDCController {
+	return &OIDCController{
+		provider:       oidc.NewProvider(cfg),
+		oidcService:    service.NewOIDCService(),
+		authController: authController,
+	}
+}
+
+// 发起SSO登录，重定向到身份提供方的授权页面
+func (c *OIDCController) Login(ctx *gin.Context) {
+	cfg := ctx.MustGet("config").(*config.Config)
+	if !cfg.OIDC.Enabled {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "未启用SSO登录"})
+		return
+	}
+
+	verifier, err := oidc.GenerateCodeVerifier()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "SSO登录初始化失败"})
+		return
+	}
+
+	state := utils.GenerateRandomString(32)
+	loginState := oidcLoginState{
+		CodeVerifier: verifier,
+		Nonce:        utils.GenerateRandomString(32),
+		DeviceName:   ctx.Query("device_name"),
+	}
+	if err := cache.Set(ctx.Request.Context(), "oidc:state:"+state, loginState, oidcStateTTL); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "SSO登录初始化失败"})
+		return
+	}
+
+	authURL, err := c.provider.AuthCodeURL(ctx.Request.Context(), state, loginState.Nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC授权地址生成失败: %v", err)
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "身份提供方不可用"})
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, authURL)
+}
+
+// SSO回调：校验state，换取并验证ID token，映射到本地用户后签发JWT
+func (c *OIDCController) Callback(ctx *gin.Context) {
+	cfg := ctx.MustGet("config").(*config.Config)
+	if !cfg.OIDC.Enabled {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "未启用SSO登录"})
+		return
+	}
+
+	if errCode := ctx.Query("error"); errCode != "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "SSO登录被拒绝: " + errCode})
+		return
+	}
+
+	state, code := ctx.Query("state"), ctx.Query("code")
+	if state == "" || code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "缺少state或code参数"})
+		return
+	}
+
+	var loginState oidcLoginState
+	if err := cache.Take(ctx.Request.Context(), "oidc:state:"+state, &loginState); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "登录状态无效或已过期"})
+		return
+	}
+
+	claims, err := c.provider.Exchange(ctx.Request.Context(), code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC token校验失败: %v", err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "SSO登录失败"})
+		return
+	}
+
+	issuer, err := c.provider.Issuer(ctx.Request.Context())
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "身份提供方不可用"})
+		return
+	}
+
+	user, reclaimed, err := c.oidcService.ResolveUser(issuer, claims, &cfg.OIDC)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSSOAccountNotFound), errors.Is(err, service.ErrSSOEmailConflict):
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrSSOEmailMissing):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "SSO登录失败"})
+		}
+		return
+	}
+
+	// 收回的账号可能有抢注者的登录会话
+	if reclaimed {
+		revoked, err := c.authController.authService.RevokeOtherSessions(user.ID, 0, &cfg.JWT)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+			return
+		}
+		websocket.DisconnectSessions(revoked...)
+	}
+
+	c.authController.completeLogin(ctx, user, user.Username, loginState.DeviceName)
+}
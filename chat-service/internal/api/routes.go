@@ -4,6 +4,7 @@ import (
 	"chat-service/internal/config"
 	"chat-service/internal/middleware"
 	"chat-service/internal/websocket"
+	"log"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,6 +13,12 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 	gin.SetMode(cfg.Server.Mode)
 	r := gin.New()
 
+	// 登录限制、限流都按ClientIP计数，只信任配置的代理传来的X-Forwarded-For，防止伪造来源IP
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Printf("trusted_proxies配置无效，不信任任何代理: %v", err)
+		r.SetTrustedProxies(nil)
+	}
+
 	// 全局中间件
 	r.Use(middleware.Logger())
 	r.Use(middleware.Recovery())
@@ -31,6 +38,16 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 	authController := NewAuthController()
 	userController := NewUserController()
 	chatController := NewChatController()
+	sessionController := NewSessionController()
+	twoFactorController := NewTwoFactorController()
+	oidcController := NewOIDCController(&cfg.OIDC, authController)
+	tokenController := NewTokenController()
+	adminController := NewAdminController()
+	memberController := NewMemberController()
+	inviteController := NewInviteController()
+	joinRequestController := NewJoinRequestController()
+	messageController := NewMessageController()
+	searchController := NewSearchController()
 
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
@@ -48,40 +65,126 @@ func SetupRouter(cfg *config.Config) *gin.Engine {
 		{
 			auth.POST("/register", authController.Register)
 			auth.POST("/login", authController.Login)
+			auth.POST("/login/2fa", authController.LoginTwoFactor)
+			auth.GET("/oidc/login", oidcController.Login)
+			auth.GET("/oidc/callback", oidcController.Callback)
+			auth.POST("/refresh", authController.Refresh)
+			auth.POST("/password/forgot", authController.ForgotPassword)
+			auth.POST("/password/reset", authController.ResetPassword)
+			auth.POST("/verify-email", authController.VerifyEmail)
+			auth.POST("/verify-email/resend", authController.ResendVerification)
 		}
 
-		// 需要认证的路由
+		// 邀请码预览，未登录用户也可以查看房间名称和成员数
+		v1.GET("/invites/:code", inviteController.PreviewInvite)
+
+		// 需要认证的路由。个人访问token按RequireScope声明的权限访问，账号敏感接口使用SessionOnly拒绝
 		protected := v1.Group("")
 		protected.Use(middleware.JWTAuth(&cfg.JWT))
 		{
+			protected.POST("/auth/logout", middleware.SessionOnly(), authController.Logout)
+
+			// 登录会话管理
+			sessions := protected.Group("/sessions", middleware.SessionOnly())
+			{
+				sessions.GET("", sessionController.GetSessions)
+				sessions.DELETE("", sessionController.RevokeOtherSessions)
+				sessions.DELETE("/:id", sessionController.RevokeSession)
+			}
+
+			// 个人访问token管理
+			tokens := protected.Group("/tokens", middleware.SessionOnly())
+			{
+				tokens.GET("", tokenController.GetTokens)
+				tokens.POST("", tokenController.CreateToken)
+				tokens.DELETE("/:id", tokenController.RevokeToken)
+			}
+
 		// 用户相关
 		users := protected.Group("/users")
 		{
-			users.GET("/profile", userController.GetProfile)
-			users.PUT("/profile", userController.UpdateProfile)
-			users.GET("/search", userController.SearchUsers)
-			users.GET("/:id", userController.GetUserByID)
+			users.GET("/profile", middleware.RequireScope(middleware.ScopeUsersRead), userController.GetProfile)
+			users.PUT("/profile", middleware.SessionOnly(), userController.UpdateProfile)
+			users.PUT("/password", middleware.SessionOnly(), userController.ChangePassword)
+			users.PUT("/privacy", middleware.SessionOnly(), userController.UpdatePrivacy)
+			users.POST("/2fa/setup", middleware.SessionOnly(), twoFactorController.Setup)
+			users.POST("/2fa/confirm", middleware.SessionOnly(), twoFactorController.Confirm)
+			users.POST("/2fa/disable", middleware.SessionOnly(), twoFactorController.Disable)
+			users.POST("/2fa/recovery-codes", middleware.SessionOnly(), twoFactorController.RegenerateRecoveryCodes)
+			users.GET("/search", middleware.RequireScope(middleware.ScopeUsersRead), userController.SearchUsers)
+			users.GET("/:id", middleware.RequireScope(middleware.ScopeUsersRead), userController.GetUserByID)
 		}
 
 			// 聊天相关
 			rooms := protected.Group("/rooms")
 			{
-				rooms.GET("", chatController.GetRooms)
-				rooms.GET("/unread", chatController.GetRoomsWithUnread)
-				rooms.POST("", chatController.CreateRoom)
-				rooms.GET("/:id", chatController.GetRoom)
-				rooms.POST("/:id/join", chatController.JoinRoom)
-				rooms.POST("/:id/leave", chatController.LeaveRoom)
-				rooms.GET("/:id/messages", chatController.GetMessages)
-				rooms.POST("/:id/read", chatController.MarkAsRead)
-				rooms.GET("/:id/unread", chatController.GetUnreadCount)
-				rooms.GET("/:id/members", chatController.GetRoomMembers)
-				rooms.POST("/:id/members", chatController.AddMember)
+				rooms.GET("", middleware.RequireScope(middleware.ScopeRoomsRead), chatController.GetRooms)
+				rooms.GET("/unread", middleware.RequireScope(middleware.ScopeRoomsRead), chatController.GetRoomsWithUnread)
+				rooms.GET("/public", middleware.RequireScope(middleware.ScopeRoomsRead), joinRequestController.GetPublicRooms)
+				rooms.POST("", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.CreateRoom)
+				rooms.GET("/:id", middleware.RequireScope(middleware.ScopeRoomsRead), chatController.GetRoom)
+				rooms.PUT("/:id", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.UpdateRoom)
+				rooms.DELETE("/:id", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.DeleteRoom)
+				rooms.POST("/:id/archive", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.ArchiveRoom)
+				rooms.DELETE("/:id/archive", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.UnarchiveRoom)
+				rooms.POST("/:id/join", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.JoinRoom)
+				rooms.POST("/:id/leave", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.LeaveRoom)
+				rooms.GET("/:id/messages", middleware.RequireScope(middleware.ScopeMessagesRead), chatController.GetMessages)
+				rooms.POST("/:id/read", middleware.RequireScope(middleware.ScopeMessagesRead), chatController.MarkAsRead)
+				rooms.GET("/:id/unread", middleware.RequireScope(middleware.ScopeMessagesRead), chatController.GetUnreadCount)
+				rooms.GET("/:id/members", middleware.RequireScope(middleware.ScopeRoomsRead), chatController.GetRoomMembers)
+				rooms.POST("/:id/members", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.AddMember)
+				rooms.PUT("/:id/members/:userId/role", middleware.RequireScope(middleware.ScopeRoomsWrite), memberController.ChangeRole)
+				rooms.DELETE("/:id/members/:userId", middleware.RequireScope(middleware.ScopeRoomsWrite), memberController.KickMember)
+				rooms.POST("/:id/members/:userId/ban", middleware.RequireScope(middleware.ScopeRoomsWrite), memberController.BanMember)
+				rooms.DELETE("/:id/members/:userId/ban", middleware.RequireScope(middleware.ScopeRoomsWrite), memberController.UnbanMember)
+				rooms.POST("/:id/members/:userId/transfer", middleware.RequireScope(middleware.ScopeRoomsWrite), memberController.TransferOwnership)
+				rooms.GET("/:id/bans", middleware.RequireScope(middleware.ScopeRoomsRead), memberController.GetBans)
+				rooms.POST("/:id/invites", middleware.RequireScope(middleware.ScopeRoomsWrite), inviteController.CreateInvite)
+				rooms.GET("/:id/invites", middleware.RequireScope(middleware.ScopeRoomsRead), inviteController.GetInvites)
+				rooms.DELETE("/:id/invites/:inviteId", middleware.RequireScope(middleware.ScopeRoomsWrite), inviteController.RevokeInvite)
+				rooms.POST("/:id/join-requests", middleware.RequireScope(middleware.ScopeRoomsWrite), joinRequestController.CreateRequest)
+				rooms.GET("/:id/join-requests", middleware.RequireScope(middleware.ScopeRoomsRead), joinRequestController.GetRequests)
+				rooms.POST("/:id/join-requests/:requestId/approve", middleware.RequireScope(middleware.ScopeRoomsWrite), joinRequestController.ApproveRequest)
+				rooms.POST("/:id/join-requests/:requestId/reject", middleware.RequireScope(middleware.ScopeRoomsWrite), joinRequestController.RejectRequest)
 			}
 
-			// WebSocket连接
-			protected.GET("/ws", websocket.HandleWebSocket)
+			// 消息相关
+			messages := protected.Group("/messages")
+			{
+				messages.POST("", middleware.RequireScope(middleware.ScopeMessagesWrite), messageController.SendMessage)
+				messages.PUT("/:id", middleware.RequireScope(middleware.ScopeMessagesWrite), messageController.EditMessage)
+				messages.DELETE("/:id", middleware.RequireScope(middleware.ScopeMessagesWrite), messageController.DeleteMessage)
+				messages.GET("/:id/history", middleware.RequireScope(middleware.ScopeMessagesRead), messageController.GetEditHistory)
+				messages.GET("/:id/thread", middleware.RequireScope(middleware.ScopeMessagesRead), messageController.GetThread)
+				messages.GET("/:id/receipts", middleware.RequireScope(middleware.ScopeMessagesRead), messageController.GetReceipts)
+				messages.POST("/:id/reactions", middleware.RequireScope(middleware.ScopeMessagesWrite), messageController.AddReaction)
+				messages.DELETE("/:id/reactions/:emoji", middleware.RequireScope(middleware.ScopeMessagesWrite), messageController.RemoveReaction)
+			}
+
+			// 消息搜索
+			protected.GET("/search/messages", middleware.RequireScope(middleware.ScopeMessagesRead), searchController.SearchMessages)
+
+			// 单聊，两人之间只有一个
+			protected.POST("/dms/:userId", middleware.RequireScope(middleware.ScopeRoomsWrite), chatController.OpenDM)
+
+			// 使用邀请码加入房间
+			protected.POST("/invites/:code/redeem", middleware.RequireScope(middleware.ScopeRoomsWrite), inviteController.RedeemInvite)
+
+			// 管理员接口
+			admin := protected.Group("/admin", middleware.SessionOnly(), middleware.RequireAdmin())
+			{
+				admin.POST("/users/:id/unlock", adminController.UnlockUser)
+				admin.GET("/users/:id/login-failures", adminController.GetLoginFailures)
+				admin.POST("/users/:id/ldap", adminController.LinkLDAPAccount)
+			}
+
+			// WebSocket连接票据
+			protected.POST("/ws/ticket", middleware.RequireScope(middleware.ScopeMessagesRead, middleware.ScopeMessagesWrite), websocket.CreateTicket)
 		}
+
+		// WebSocket连接，使用/ws/ticket签发的一次性票据认证
+		v1.GET("/ws", websocket.HandleWebSocket)
 	}
 
 	return r
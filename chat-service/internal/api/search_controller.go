@@ -0,0 +1,103 @@
+package api
+
+import (
+	"chat-service/internal/service"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchController struct {
+	searchService *service.SearchService
+}
+
+func NewSearchController() *SearchController {
+	return &SearchController{
+		searchService: service.NewSearchService(),
+	}
+}
+
+// 搜索当前用户所在房间的消息，按时间从新到旧返回，使用next_cursor获取下一页
+func (c *SearchController) SearchMessages(ctx *gin.Context) {
+	opts := service.SearchOptions{Query: ctx.Query("q")}
+
+	var err error
+	if opts.RoomID, err = parseUintQuery(ctx, "room_id"); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的房间ID"})
+		return
+	}
+	if opts.SenderID, err = parseUintQuery(ctx, "sender_id"); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的发送者ID"})
+		return
+	}
+	if opts.Cursor, err = parseUintQuery(ctx, "cursor"); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的游标"})
+		return
+	}
+	if opts.From, err = parseTimeQuery(ctx, "from", false); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间"})
+		return
+	}
+	if opts.To, err = parseTimeQuery(ctx, "to", true); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间"})
+		return
+	}
+
+	opts.PageSize, _ = strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+	if opts.PageSize < 1 || opts.PageSize > 100 {
+		opts.PageSize = 20
+	}
+
+	results, nextCursor, err := c.searchService.SearchMessages(ctx.GetUint("user_id"), opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSearchQueryTooShort):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrNotRoomMember):
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			log.Printf("搜索消息失败: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "搜索消息失败"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"results":     results,
+		"next_cursor": nextCursor,
+	})
+}
+
+// parseUintQuery 解析可选的ID参数，没有传时返回0
+func parseUintQuery(ctx *gin.Context, key string) (uint, error) {
+	value := ctx.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	return uint(id), err
+}
+
+// parseTimeQuery 解析可选的时间参数，支持RFC3339和2006-01-02。
+// 只有日期的结束时间包含当天，即取第二天零点
+func parseTimeQuery(ctx *gin.Context, key string, endOfDay bool) (*time.Time, error) {
+	value := ctx.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
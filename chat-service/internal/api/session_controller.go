@@ -0,0 +1,88 @@
+package api
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/service"
+	"chat-service/internal/websocket"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionController struct {
+	authService *service.AuthService
+}
+
+func NewSessionController() *SessionController {
+	return &SessionController{
+		authService: service.NewAuthService(),
+	}
+}
+
+// 获取当前用户的活跃会话列表
+func (c *SessionController) GetSessions(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	currentID := ctx.GetUint("session_id")
+	cfg := ctx.MustGet("config").(*config.Config)
+
+	sessions, err := c.authService.GetActiveSessions(userID, &cfg.JWT)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, gin.H{
+			"id":           session.ID,
+			"device_name":  session.DeviceName,
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"current":      session.ID == currentID,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"sessions": result})
+}
+
+// 吊销指定会话
+func (c *SessionController) RevokeSession(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	sessionID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的会话ID"})
+		return
+	}
+
+	cfg := ctx.MustGet("config").(*config.Config)
+	if err := c.authService.RevokeSession(userID, uint(sessionID), &cfg.JWT); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+		return
+	}
+
+	websocket.DisconnectSessions(uint(sessionID))
+	ctx.JSON(http.StatusOK, gin.H{"message": "会话已吊销"})
+}
+
+// 吊销除当前会话以外的所有会话
+func (c *SessionController) RevokeOtherSessions(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	cfg := ctx.MustGet("config").(*config.Config)
+
+	revoked, err := c.authService.RevokeOtherSessions(userID, ctx.GetUint("session_id"), &cfg.JWT)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+		return
+	}
+
+	websocket.DisconnectSessions(revoked...)
+	ctx.JSON(http.StatusOK, gin.H{"message": "其他会话已吊销", "revoked_count": len(revoked)})
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"chat-service/internal/service"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TokenController struct {
+	tokenService *service.PersonalTokenService
+}
+
+func NewTokenController() *TokenController {
+	return &TokenController{
+		tokenService: service.NewPersonalTokenService(),
+	}
+}
+
+// 创建个人访问token请求结构，ExpiresInDays为0表示永不过期
+type CreateTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"`
+}
+
+// 创建个人访问token
+func (c *TokenController) CreateToken(ctx *gin.Context) {
+	var req CreateTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	userID := ctx.GetUint("user_id")
+	raw, token, err := c.tokenService.CreateToken(userID, strings.TrimSpace(req.Name), req.Scopes, expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidScope), errors.Is(err, service.ErrPersonalTokenLimit):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "创建token失败"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"message": "创建成功，token只显示一次，请妥善保存",
+		"token":   raw,
+		"info":    token,
+	})
+}
+
+// 获取个人访问token列表
+func (c *TokenController) GetTokens(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+
+	tokens, err := c.tokenService.GetTokens(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "获取token列表失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// 吊销个人访问token
+func (c *TokenController) RevokeToken(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	tokenID, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "无效的token ID"})
+		return
+	}
+
+	if err := c.tokenService.RevokeToken(userID, uint(tokenID)); err != nil {
+		if errors.Is(err, service.ErrPersonalTokenNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "吊销token失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "token已吊销"})
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TwoFactorController struct {
+	twoFactorService *service.TwoFactorService
+}
+
+func NewTwoFactorController() *TwoFactorController {
+	return &TwoFactorController{
+		twoFactorService: service.NewTwoFactorService(),
+	}
+}
+
+// 两步验证码请求结构
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// 关闭两步验证请求结构
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// 生成TOTP密钥，返回密钥和用于生成二维码的otpauth地址
+func (c *TwoFactorController) Setup(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	cfg := ctx.MustGet("config").(*config.Config)
+
+	secret, uri, err := c.twoFactorService.Setup(userID, cfg)
+	if err != nil {
+		if errors.Is(err, service.ErrTwoFactorAlreadyEnabled) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "生成两步验证密钥失败"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": uri,
+	})
+}
+
+// 使用验证码确认密钥，开启两步验证并返回恢复码
+func (c *TwoFactorController) Confirm(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := c.twoFactorService.Confirm(userID, req.Code)
+	if err != nil {
+		c.handleError(ctx, err, "开启两步验证失败")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "两步验证已开启",
+		"recovery_codes": codes,
+	})
+}
+
+// 关闭两步验证
+func (c *TwoFactorController) Disable(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	var req DisableTwoFactorRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.twoFactorService.Disable(userID, req.Password, req.Code); err != nil {
+		c.handleError(ctx, err, "关闭两步验证失败")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// 重新生成恢复码
+func (c *TwoFactorController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	userID := ctx.GetUint("user_id")
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := c.twoFactorService.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		c.handleError(ctx, err, "生成恢复码失败")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (c *TwoFactorController) handleError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrWrongPassword):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled),
+		errors.Is(err, service.ErrTwoFactorNotSetup):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -12,6 +12,13 @@ type Config struct {
 	Redis    RedisConfig    `mapstructure:"redis"`
 	RabbitMQ RabbitMQConfig `mapstructure:"rabbitmq"`
 	JWT      JWTConfig      `mapstructure:"jwt"`
+	Auth     AuthConfig     `mapstructure:"auth"`
+	OIDC     OIDCConfig     `mapstructure:"oidc"`
+	LDAP     LDAPConfig     `mapstructure:"ldap"`
+	Password PasswordConfig `mapstructure:"password"`
+	Mail     MailConfig     `mapstructure:"mail"`
+	Room     RoomConfig     `mapstructure:"room"`
+	Message  MessageConfig  `mapstructure:"message"`
 }
 
 type ServerConfig struct {
@@ -20,6 +27,9 @@ type ServerConfig struct {
 	Mode         string `mapstructure:"mode"`
 	ReadTimeout  int    `mapstructure:"read_timeout"`
 	WriteTimeout int    `mapstructure:"write_timeout"`
+	PublicURL    string `mapstructure:"public_url"` // 邮件链接等对外地址
+	// TrustedProxies 信任其X-Forwarded-For的反向代理地址或网段，为空时直接使用连接的来源IP
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type DatabaseConfig struct {
@@ -46,8 +56,89 @@ type RabbitMQConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string `mapstructure:"secret"`
-	ExpireHour int    `mapstructure:"expire_hour"`
+	Secret             string `mapstructure:"secret"`
+	ExpireHour         int    `mapstructure:"expire_hour"`          // 未配置access_expire_minute时access token的有效期
+	AccessExpireMinute int    `mapstructure:"access_expire_minute"` // access token有效期（分钟）
+	RefreshExpireHour  int    `mapstructure:"refresh_expire_hour"`  // refresh token有效期（小时）
+}
+
+type AuthConfig struct {
+	Backends []string `mapstructure:"backends"` // 密码登录时按顺序尝试的认证方式: ldap, local
+
+	RequireEmailVerification bool `mapstructure:"require_email_verification"` // 未验证邮箱的用户不能登录
+	VerifyExpireHour         int  `mapstructure:"verify_expire_hour"`
+	VerifyResendInterval     int  `mapstructure:"verify_resend_interval"` // 重发验证邮件的最小间隔（秒）
+
+	TOTPIssuer string `mapstructure:"totp_issuer"` // 身份验证器App中显示的服务名
+
+	MaxFailedAttempts   int `mapstructure:"max_failed_attempts"`    // 同一用户名连续失败多少次后锁定账号
+	IPMaxFailedAttempts int `mapstructure:"ip_max_failed_attempts"` // 同一IP失败多少次后暂停该IP登录
+	FailureWindowMinute int `mapstructure:"failure_window_minute"`  // 失败次数的统计窗口（分钟）
+	LockoutMinute       int `mapstructure:"lockout_minute"`         // 锁定时长（分钟）
+	BackoffBaseSecond   int `mapstructure:"backoff_base_second"`    // 每次失败后等待时间从该值开始翻倍
+	BackoffMaxSecond    int `mapstructure:"backoff_max_second"`
+}
+
+type OIDCConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	Issuer        string   `mapstructure:"issuer"`
+	ClientID      string   `mapstructure:"client_id"`
+	ClientSecret  string   `mapstructure:"client_secret"`
+	RedirectURL   string   `mapstructure:"redirect_url"` // 指向 /api/v1/auth/oidc/callback
+	Scopes        []string `mapstructure:"scopes"`
+	AutoProvision bool     `mapstructure:"auto_provision"` // 首次登录时自动创建本地用户
+}
+
+type LDAPConfig struct {
+	URL                string          `mapstructure:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool            `mapstructure:"start_tls"`
+	InsecureSkipVerify bool            `mapstructure:"insecure_skip_verify"`
+	BindDN             string          `mapstructure:"bind_dn"` // 用于查找用户的服务账号，为空时匿名查找
+	BindPassword       string          `mapstructure:"bind_password"`
+	BaseDN             string          `mapstructure:"base_dn"`
+	UserFilter         string          `mapstructure:"user_filter"` // %s会被替换为转义后的用户名
+	EmailAttribute     string          `mapstructure:"email_attribute"`
+	NameAttribute      string          `mapstructure:"name_attribute"`
+	GroupAttribute     string          `mapstructure:"group_attribute"`
+	GroupRoles         []LDAPGroupRole `mapstructure:"group_roles"`
+	AdminGroups        []string        `mapstructure:"admin_groups"` // 只有列在这里的组才能通过group_roles映射为admin，默认LDAP不授予管理员
+	AutoProvision      bool            `mapstructure:"auto_provision"`
+	FallbackToLocal    bool            `mapstructure:"fallback_to_local"` // 目录不可用时改用本地密码校验
+}
+
+// LDAPGroupRole LDAP组到用户角色的映射
+type LDAPGroupRole struct {
+	Group string `mapstructure:"group"` // 组的DN
+	Role  string `mapstructure:"role"`
+}
+
+type PasswordConfig struct {
+	MinLength         int  `mapstructure:"min_length"`
+	RequireUpper      bool `mapstructure:"require_upper"`
+	RequireLower      bool `mapstructure:"require_lower"`
+	RequireDigit      bool `mapstructure:"require_digit"`
+	RequireSymbol     bool `mapstructure:"require_symbol"`
+	ResetExpireMinute int  `mapstructure:"reset_expire_minute"`
+}
+
+type MailConfig struct {
+	Driver   string `mapstructure:"driver"` // smtp, file, log
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	From     string `mapstructure:"from"`
+	FilePath string `mapstructure:"file_path"`
+}
+
+type RoomConfig struct {
+	DefaultMaxMembers int `mapstructure:"default_max_members"` // 创建群聊时未指定max_members使用的人数上限
+	MaxMembersLimit   int `mapstructure:"max_members_limit"`   // 群聊可设置的max_members最大值
+	MaxInitialMembers int `mapstructure:"max_initial_members"` // 创建群聊时member_ids的最大数量
+}
+
+type MessageConfig struct {
+	EditWindowMinute int `mapstructure:"edit_window_minute"` // 发送后多少分钟内可以编辑，0表示不限制
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -77,6 +168,7 @@ func setDefaults() {
 	viper.SetDefault("server.mode", "debug")
 	viper.SetDefault("server.read_timeout", 60)
 	viper.SetDefault("server.write_timeout", 60)
+	viper.SetDefault("server.public_url", "http://localhost:8080")
 
 	// 数据库默认配置
 	viper.SetDefault("database.host", "localhost")
@@ -101,4 +193,54 @@ func setDefaults() {
 	// JWT默认配置
 	viper.SetDefault("jwt.secret", "your-secret-key-change-in-production")
 	viper.SetDefault("jwt.expire_hour", 24)
+	viper.SetDefault("jwt.access_expire_minute", 15)
+	viper.SetDefault("jwt.refresh_expire_hour", 168)
+
+	// 认证默认配置
+	viper.SetDefault("auth.backends", []string{"local"})
+	viper.SetDefault("auth.require_email_verification", false)
+	viper.SetDefault("auth.verify_expire_hour", 24)
+	viper.SetDefault("auth.verify_resend_interval", 60)
+	viper.SetDefault("auth.totp_issuer", "Chat Service")
+	viper.SetDefault("auth.max_failed_attempts", 5)
+	viper.SetDefault("auth.ip_max_failed_attempts", 20)
+	viper.SetDefault("auth.failure_window_minute", 15)
+	viper.SetDefault("auth.lockout_minute", 15)
+	viper.SetDefault("auth.backoff_base_second", 1)
+	viper.SetDefault("auth.backoff_max_second", 60)
+
+	// OIDC单点登录默认配置
+	viper.SetDefault("oidc.enabled", false)
+	viper.SetDefault("oidc.redirect_url", "http://localhost:8080/api/v1/auth/oidc/callback")
+	viper.SetDefault("oidc.scopes", []string{"openid", "profile", "email"})
+	viper.SetDefault("oidc.auto_provision", true)
+
+	// LDAP默认配置
+	viper.SetDefault("ldap.user_filter", "(uid=%s)")
+	viper.SetDefault("ldap.email_attribute", "mail")
+	viper.SetDefault("ldap.name_attribute", "displayName")
+	viper.SetDefault("ldap.group_attribute", "memberOf")
+	viper.SetDefault("ldap.auto_provision", true)
+
+	// 密码策略默认配置
+	viper.SetDefault("password.min_length", 8)
+	viper.SetDefault("password.require_upper", false)
+	viper.SetDefault("password.require_lower", true)
+	viper.SetDefault("password.require_digit", true)
+	viper.SetDefault("password.require_symbol", false)
+	viper.SetDefault("password.reset_expire_minute", 30)
+
+	// 邮件默认配置
+	viper.SetDefault("mail.driver", "log")
+	viper.SetDefault("mail.port", "587")
+	viper.SetDefault("mail.from", "no-reply@chat.local")
+	viper.SetDefault("mail.file_path", "mail.log")
+
+	// 房间默认配置
+	viper.SetDefault("room.default_max_members", 100)
+	viper.SetDefault("room.max_members_limit", 500)
+	viper.SetDefault("room.max_initial_members", 50)
+
+	// 消息默认配置
+	viper.SetDefault("message.edit_window_minute", 15)
 }
@@ -24,7 +24,8 @@ func InitDB(cfg *config.DatabaseConfig) error {
 
 	var err error
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger:         logger.Default.LogMode(logger.Info),
+		TranslateError: true, // 唯一索引冲突返回gorm.ErrDuplicatedKey
 	})
 
 	if err != nil {
@@ -46,8 +47,22 @@ func InitDB(cfg *config.DatabaseConfig) error {
 		&models.ChatRoom{},
 		&models.RoomMember{},
 		&models.Message{},
+		&models.MessageEdit{},
+		&models.HiddenMessage{},
+		&models.MessageReaction{},
+		&models.MessageMention{},
 		&models.UnreadMessage{},
 		&models.OnlineUser{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.PersonalAccessToken{},
+		&models.LoginAttempt{},
+		&models.RoomBan{},
+		&models.RoomInvite{},
+		&models.RoomJoinRequest{},
 	)
 
 	if err != nil {
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin 要求当前用户为管理员，需放在JWTAuth之后。角色每次从数据库读取，降级后立即生效
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user models.User
+		if err := database.GetDB().Select("id", "role").First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+			c.Abort()
+			return
+		}
+		if user.Role != models.UserRoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
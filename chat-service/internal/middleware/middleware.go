@@ -2,8 +2,9 @@ package middleware
 
 import (
 	"chat-service/internal/config"
+	"chat-service/pkg/cache"
+	"chat-service/pkg/utils"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -13,25 +14,23 @@ import (
 )
 
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID     uint `json:"user_id"`
+	SessionID  uint `json:"sid,omitempty"`
+	Unverified bool `json:"unv,omitempty"` // 签发时用户邮箱尚未验证
 	jwt.RegisteredClaims
 }
 
 func JWTAuth(cfg *config.JWTConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 只接受Authorization头，token放在URL中会出现在代理和访问日志里。
+		// WebSocket连接使用一次性票据，见websocket.HandleWebSocket
 		authHeader := c.GetHeader("Authorization")
-		authToken := c.Query("token")
-		log.Printf("header:%v, authToken:%v", authHeader, authToken)
-		if authHeader == "" && authToken == "" {
+		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "缺少认证token"})
 			c.Abort()
 			return
 		}
 
-		if authHeader == "" && authToken != "" {
-			authHeader = "Bearer " + authToken
-		}
-
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		if tokenString == authHeader {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "认证格式错误"})
@@ -39,6 +38,11 @@ func JWTAuth(cfg *config.JWTConfig) gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(tokenString, PersonalTokenPrefix) {
+			authenticatePersonalToken(c, tokenString)
+			return
+		}
+
 		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 			return []byte(cfg.Secret), nil
 		})
@@ -56,18 +60,55 @@ func JWTAuth(cfg *config.JWTConfig) gin.HandlerFunc {
 			return
 		}
 
+		// 检查token是否已被吊销（登出、刷新token被盗用等）
+		revoked, err := cache.IsTokenRevoked(c.Request.Context(), claims.ID, claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "认证服务暂不可用"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token已失效"})
+			c.Abort()
+			return
+		}
+
+		// 开启邮箱验证要求时拒绝未验证用户的token
+		if claims.Unverified {
+			if appCfg, ok := c.Get("config"); ok && appCfg.(*config.Config).Auth.RequireEmailVerification {
+				c.JSON(http.StatusForbidden, gin.H{"error": "邮箱未验证"})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("token_id", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
 		c.Next()
 	}
 }
 
+// GenerateToken 生成不属于任何会话的access token
 func GenerateToken(userID uint, cfg *config.JWTConfig) (string, error) {
+	return GenerateSessionToken(userID, 0, false, cfg)
+}
+
+// GenerateSessionToken 生成短期有效的access token，每个token带有唯一的jti以便吊销
+func GenerateSessionToken(userID, sessionID uint, unverified bool, cfg *config.JWTConfig) (string, error) {
+	now := time.Now()
 	claims := Claims{
-		UserID: userID,
+		UserID:     userID,
+		SessionID:  sessionID,
+		Unverified: unverified,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.ExpireHour) * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        utils.GenerateRandomString(32),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL(cfg))),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
@@ -75,6 +116,14 @@ func GenerateToken(userID uint, cfg *config.JWTConfig) (string, error) {
 	return token.SignedString([]byte(cfg.Secret))
 }
 
+// AccessTokenTTL 返回access token的有效期
+func AccessTokenTTL(cfg *config.JWTConfig) time.Duration {
+	if cfg.AccessExpireMinute > 0 {
+		return time.Duration(cfg.AccessExpireMinute) * time.Minute
+	}
+	return time.Duration(cfg.ExpireHour) * time.Hour
+}
+
 func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
@@ -124,13 +173,16 @@ func RateLimiter() gin.HandlerFunc {
 	}
 }
 
+// sensitiveQueryParams 访问日志中需要隐藏取值的URL参数
+var sensitiveQueryParams = []string{"token", "ticket", "access_token", "refresh_token", "code", "password"}
+
 func Logger() gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
 			param.ClientIP,
 			param.TimeStamp.Format("02/Jan/2006:15:04:05 -0700"),
 			param.Method,
-			param.Path,
+			ScrubPath(param.Path),
 			param.Request.Proto,
 			param.StatusCode,
 			param.Latency,
@@ -140,6 +192,29 @@ func Logger() gin.HandlerFunc {
 	})
 }
 
+// ScrubPath 将路径中敏感URL参数的值替换为***
+func ScrubPath(path string) string {
+	i := strings.IndexByte(path, '?')
+	if i < 0 {
+		return path
+	}
+
+	params := strings.Split(path[i+1:], "&")
+	for j, param := range params {
+		name := param
+		if k := strings.IndexByte(param, '='); k >= 0 {
+			name = param[:k]
+		}
+		for _, sensitive := range sensitiveQueryParams {
+			if strings.EqualFold(name, sensitive) {
+				params[j] = name + "=***"
+				break
+			}
+		}
+	}
+	return path[:i+1] + strings.Join(params, "&")
+}
+
 func Recovery() gin.HandlerFunc {
 	return gin.RecoveryWithWriter(gin.DefaultWriter, func(c *gin.Context, recovered interface{}) {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -6,6 +6,18 @@ import (
 	"gorm.io/gorm"
 )
 
+// 用户状态
+const (
+	UserStatusActive              = "active"
+	UserStatusPendingVerification = "pending_verification"
+)
+
+// 用户全局角色
+const (
+	UserRoleUser  = "user"
+	UserRoleAdmin = "admin"
+)
+
 // User 用户模型
 type User struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
@@ -15,23 +27,70 @@ type User struct {
 	Email     string         `gorm:"uniqueIndex;size:100" json:"email"`
 	Password  string         `gorm:"size:255" json:"-"`
 	Status    string         `gorm:"size:20;default:'active'" json:"status"`
+	Role      string         `gorm:"size:20;default:'user'" json:"-"` // user, admin，只在本人资料中返回
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	TOTPSecret  string `gorm:"column:totp_secret;size:64" json:"-"`        // 未确认前也会保存，以TOTPEnabled为准
+	TOTPEnabled bool   `gorm:"column:totp_enabled;default:false" json:"-"` // 是否开启两步验证，只在本人资料中返回
+
+	PendingEmail string `gorm:"size:100;index" json:"-"` // 修改后待验证的新邮箱，验证通过后才替换Email
+
+	HideReadReceipts bool `gorm:"default:false" json:"-"` // 不向其他成员展示自己的已读和送达状态，只在本人资料中返回
 }
 
+// 房间成员角色
+const (
+	RoomRoleOwner  = "owner"
+	RoomRoleAdmin  = "admin"
+	RoomRoleMember = "member"
+)
+
+// 房间可见性
+const (
+	RoomVisibilityPublic        = "public"          // 出现在公开目录中，任何人都可以直接加入
+	RoomVisibilityInviteOnly    = "invite_only"     // 只能通过成员邀请或邀请码加入
+	RoomVisibilityRequestToJoin = "request_to_join" // 出现在公开目录中，申请经管理员同意后加入
+)
+
+// 消息回执状态
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead      = "read"
+)
+
+// @的类型
+const (
+	MentionUser = "user" // @username
+	MentionHere = "here" // @here，房间中当前在线的成员
+	MentionAll  = "all"  // @all，房间所有成员
+)
+
+// 加入申请状态
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
 // ChatRoom 聊天室模型
 type ChatRoom struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"size:100" json:"name"`
-	Description string         `gorm:"size:500" json:"description"`
-	Type        string         `gorm:"size:20;default:'group'" json:"type"` // single, group
-	Avatar      string         `gorm:"size:255" json:"avatar"`
-	OwnerID     uint           `json:"owner_id"`
-	MaxMembers  int            `gorm:"default:100" json:"max_members"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	Name             string         `gorm:"size:100" json:"name"`
+	Description      string         `gorm:"size:500" json:"description"`
+	Type             string         `gorm:"size:20;default:'group'" json:"type"` // single, group
+	Avatar           string         `gorm:"size:255" json:"avatar"`
+	OwnerID          uint           `json:"owner_id"`
+	MaxMembers       int            `gorm:"default:100" json:"max_members"`
+	OnlyAdminsPost   bool           `gorm:"default:false" json:"only_admins_post"`                 // 只有群主和管理员可以发言
+	OnlyAdminsInvite bool           `gorm:"default:false" json:"only_admins_invite"`               // 只有群主和管理员可以邀请成员
+	Visibility       string         `gorm:"size:20;default:'invite_only';index" json:"visibility"` // public, invite_only, request_to_join
+	ArchivedAt       *time.Time     `json:"archived_at"`                                           // 归档后房间只读
+	DMKey            *string        `gorm:"column:dm_key;size:50;uniqueIndex" json:"-"`            // 单聊双方的用户ID，保证两人之间只有一个单聊
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Owner    User         `gorm:"foreignKey:OwnerID" json:"owner"`
 	Members  []RoomMember `gorm:"foreignKey:RoomID" json:"members"`
@@ -40,36 +99,129 @@ type ChatRoom struct {
 
 // RoomMember 聊天室成员
 type RoomMember struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	RoomID    uint           `json:"room_id"`
-	UserID    uint           `json:"user_id"`
-	Role      string         `gorm:"size:20;default:'member'" json:"role"` // owner, admin, member
-	JoinedAt  time.Time      `json:"joined_at"`
-	LastRead  time.Time      `json:"last_read"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                     uint           `gorm:"primaryKey" json:"id"`
+	RoomID                 uint           `json:"room_id"`
+	UserID                 uint           `json:"user_id"`
+	Role                   string         `gorm:"size:20;default:'member'" json:"role"` // owner, admin, member
+	JoinedAt               time.Time      `json:"joined_at"`
+	LastRead               time.Time      `json:"-"`                  // 已读位置只通过回执接口返回，遵循成员的隐私设置
+	LastReadMessageID      uint           `gorm:"default:0" json:"-"` // 已读到的消息ID
+	LastDeliveredMessageID uint           `gorm:"default:0" json:"-"` // 已送达的消息ID
+	CreatedAt              time.Time      `json:"created_at"`
+	UpdatedAt              time.Time      `json:"updated_at"`
+	DeletedAt              gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Room ChatRoom `gorm:"foreignKey:RoomID" json:"room"`
 	User User     `gorm:"foreignKey:UserID" json:"user"`
 }
 
+// RoomBan 房间封禁记录，被封禁的用户不能再加入该房间
+type RoomBan struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	RoomID    uint      `gorm:"uniqueIndex:idx_room_bans_room_user" json:"room_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_room_bans_room_user" json:"user_id"`
+	BannedBy  uint      `json:"banned_by"`
+	Reason    string    `gorm:"size:255" json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"user"`
+}
+
+// RoomInvite 房间邀请码，任何持有邀请码的用户都可以加入房间
+type RoomInvite struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	RoomID    uint       `gorm:"index" json:"room_id"`
+	Code      string     `gorm:"size:32;uniqueIndex" json:"code"`
+	CreatedBy uint       `json:"created_by"`
+	Role      string     `gorm:"size:20;default:'member'" json:"role"` // 通过邀请加入后的角色
+	MaxUses   int        `json:"max_uses"`                             // 0表示不限次数
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	Creator User `gorm:"foreignKey:CreatedBy" json:"creator"`
+}
+
+// RoomJoinRequest 加入房间的申请，由群主或管理员审核
+type RoomJoinRequest struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	RoomID     uint       `gorm:"index:idx_room_join_requests_room_status" json:"room_id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Message    string     `gorm:"size:255" json:"message"`
+	Status     string     `gorm:"size:20;default:'pending';index:idx_room_join_requests_room_status" json:"status"`
+	ReviewedBy *uint      `json:"reviewed_by"`
+	ReviewedAt *time.Time `json:"reviewed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"user"`
+}
+
 // Message 消息模型
 type Message struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	RoomID    uint           `json:"room_id"`
-	SenderID  uint           `json:"sender_id"`
-	Content   string         `gorm:"type:text" json:"content"`
-	Type      string         `gorm:"size:20;default:'text'" json:"type"` // text, image, file, system
-	ReplyToID *uint          `json:"reply_to_id"`                        // 回复的消息ID
-	IsDeleted bool           `gorm:"default:false" json:"is_deleted"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	RoomID      uint           `json:"room_id"`
+	SenderID    uint           `json:"sender_id"`
+	Content     string         `gorm:"type:text;index:idx_messages_content,class:FULLTEXT,option:WITH PARSER ngram" json:"content"`
+	Type        string         `gorm:"size:20;default:'text'" json:"type"` // text, image, file, system
+	ReplyToID   *uint          `json:"reply_to_id"`                        // 回复的消息ID，总是指向话题的第一条消息
+	IsDeleted   bool           `gorm:"default:false" json:"is_deleted"`
+	ReplyCount  int            `gorm:"default:0" json:"reply_count"` // 话题中的回复数
+	LastReplyAt *time.Time     `json:"last_reply_at"`                // 话题中最后一条回复的时间
+	EditedAt    *time.Time     `json:"edited_at"`                    // 最后一次编辑的时间，未编辑过为空
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Sender  User     `gorm:"foreignKey:SenderID" json:"sender"`
 	Room    ChatRoom `gorm:"foreignKey:RoomID" json:"room"`
 	ReplyTo *Message `gorm:"foreignKey:ReplyToID" json:"reply_to_message,omitempty"`
+
+	Reactions []ReactionSummary `gorm:"-" json:"reactions,omitempty"` // 按表情汇总的回应，查询消息列表时填充
+}
+
+// MessageReaction 用户对消息的表情回应，同一用户对同一消息的同一表情只有一条
+type MessageReaction struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"uniqueIndex:idx_message_reactions_message_user_emoji" json:"message_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_message_reactions_message_user_emoji;index" json:"user_id"`
+	Emoji     string    `gorm:"type:varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;uniqueIndex:idx_message_reactions_message_user_emoji" json:"emoji"` // 区分大小写和不同的表情
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary 消息上某个表情的回应人数
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int64  `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// MessageMention 消息中@到的用户，同一消息中每个用户只记录一次
+type MessageMention struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"uniqueIndex:idx_message_mentions_message_user" json:"message_id"`
+	RoomID    uint      `gorm:"index:idx_message_mentions_user_room" json:"room_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_message_mentions_message_user;index:idx_message_mentions_user_room,priority:1" json:"user_id"`
+	Kind      string    `gorm:"size:10" json:"kind"` // user, here, all
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HiddenMessage 用户"仅为自己删除"的消息，只对该用户隐藏
+type HiddenMessage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_hidden_messages_user_message" json:"user_id"`
+	MessageID uint      `gorm:"uniqueIndex:idx_hidden_messages_user_message;index" json:"message_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageEdit 消息编辑前的内容，每次编辑保存一条
+type MessageEdit struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"index" json:"message_id"`
+	Content   string    `gorm:"type:text" json:"content"`
+	CreatedAt time.Time `json:"created_at"` // 被替换的时间
 }
 
 // UnreadMessage 未读消息计数
@@ -97,3 +249,84 @@ type OnlineUser struct {
 
 	User User `gorm:"foreignKey:UserID" json:"user"`
 }
+
+// Session 登录会话，每次登录对应一个设备会话
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	DeviceName string     `gorm:"size:100" json:"device_name"`
+	UserAgent  string     `gorm:"size:255" json:"user_agent"`
+	IP         string     `gorm:"size:64" json:"ip"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// RefreshToken 刷新token，只保存哈希；同一次登录轮换出的token属于同一个Family，
+// 每个Family对应一个会话
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	SessionID uint       `gorm:"index" json:"session_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64" json:"-"`
+	FamilyID  string     `gorm:"index;size:64" json:"family_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PasswordResetToken 重置密码token，只保存哈希，使用一次后失效
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RecoveryCode 两步验证的一次性恢复码，只保存哈希
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	CodeHash  string     `gorm:"uniqueIndex;size:64" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserIdentity 外部身份提供方账号与本地用户的关联
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Provider  string    `gorm:"size:255;uniqueIndex:idx_user_identities_provider_subject" json:"provider"` // OIDC为issuer
+	Subject   string    `gorm:"size:255;uniqueIndex:idx_user_identities_provider_subject" json:"subject"`
+	Email     string    `gorm:"size:100" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PersonalAccessToken 供脚本调用API的长期token，只保存哈希，权限由Scopes限定
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Name       string     `gorm:"size:100" json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex;size:64" json:"-"`
+	Prefix     string     `gorm:"size:20" json:"prefix"`  // token的前几位，便于用户辨认
+	Scopes     string     `gorm:"size:255" json:"scopes"` // 以空格分隔
+	ExpiresAt  *time.Time `json:"expires_at"`             // 为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// LoginAttempt 登录失败的审计记录
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Username  string    `gorm:"size:100;index" json:"username"`
+	IP        string    `gorm:"size:64;index" json:"ip"`
+	UserAgent string    `gorm:"size:255" json:"user_agent"`
+	Reason    string    `gorm:"size:30" json:"reason"` // invalid_credentials, invalid_2fa_code, locked, throttled
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/database"
+	"chat-service/internal/middleware"
+	"chat-service/internal/models"
+	"chat-service/pkg/cache"
+	"chat-service/pkg/utils"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("无效的刷新token")
+	ErrRefreshTokenReused  = errors.New("刷新token已被使用")
+	ErrSessionNotFound     = errors.New("会话不存在")
+)
+
+type AuthService struct{}
+
+// TokenPair 登录/刷新后返回给客户端的token对
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token有效期（秒）
+	SessionID    uint   `json:"session_id"`
+}
+
+// SessionInfo 创建会话时记录的客户端信息
+type SessionInfo struct {
+	DeviceName string
+	UserAgent  string
+	IP         string
+}
+
+func NewAuthService() *AuthService {
+	return &AuthService{}
+}
+
+// IssueTokens 为一次新的登录创建会话，开启新的刷新token家族并签发token对
+func (s *AuthService) IssueTokens(userID uint, info SessionInfo, cfg *config.JWTConfig) (*TokenPair, error) {
+	var pair *TokenPair
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		session := &models.Session{
+			UserID:     userID,
+			DeviceName: truncate(info.DeviceName, 100),
+			UserAgent:  truncate(info.UserAgent, 255),
+			IP:         info.IP,
+			LastUsedAt: time.Now(),
+		}
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = s.issueTokens(tx, userID, session.ID, utils.GenerateRandomString(32), cfg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RefreshTokens 使用刷新token换取新的token对。每个刷新token只能使用一次，
+// 已使用过的token再次出现说明可能被盗用，此时吊销整个家族及其会话
+func (s *AuthService) RefreshTokens(refreshToken string, cfg *config.JWTConfig) (*TokenPair, error) {
+	var pair *TokenPair
+	var rt models.RefreshToken
+	reused := false
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", utils.HashToken(refreshToken)).First(&rt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+
+		if rt.RevokedAt != nil || time.Now().After(rt.ExpiresAt) {
+			return ErrRefreshTokenInvalid
+		}
+
+		if rt.UsedAt != nil {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		// 带条件更新，防止并发请求重复使用同一个token
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", rt.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		if err := tx.Model(&models.Session{}).
+			Where("id = ?", rt.SessionID).
+			Update("last_used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = s.issueTokens(tx, rt.UserID, rt.SessionID, rt.FamilyID, cfg)
+		return err
+	})
+
+	if reused {
+		if revokeErr := s.revokeFamily(&rt, cfg); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// GetActiveSessions 获取用户所有未吊销且未过期的会话
+func (s *AuthService) GetActiveSessions(userID uint, cfg *config.JWTConfig) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.GetDB().
+		Where("user_id = ? AND revoked_at IS NULL AND last_used_at > ?",
+			userID, time.Now().Add(-time.Duration(cfg.RefreshExpireHour)*time.Hour)).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeSession 吊销用户的某个会话
+func (s *AuthService) RevokeSession(userID, sessionID uint, cfg *config.JWTConfig) error {
+	revoked, err := s.revokeSessions(userID, []uint{sessionID}, cfg)
+	if err != nil {
+		return err
+	}
+	if len(revoked) == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeRefreshToken 吊销刷新token所在的整个家族及其会话（用于登出），返回被吊销的会话ID
+func (s *AuthService) RevokeRefreshToken(userID uint, refreshToken string, cfg *config.JWTConfig) (uint, error) {
+	var rt models.RefreshToken
+	err := database.GetDB().
+		Where("token_hash = ? AND user_id = ?", utils.HashToken(refreshToken), userID).
+		First(&rt).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrRefreshTokenInvalid
+		}
+		return 0, err
+	}
+	return rt.SessionID, s.revokeFamily(&rt, cfg)
+}
+
+// RevokeOtherSessions 吊销用户除keepSessionID以外的所有会话，返回被吊销的会话ID
+func (s *AuthService) RevokeOtherSessions(userID, keepSessionID uint, cfg *config.JWTConfig) ([]uint, error) {
+	var ids []uint
+	err := database.GetDB().Model(&models.Session{}).
+		Where("user_id = ? AND id != ? AND revoked_at IS NULL", userID, keepSessionID).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.revokeSessions(userID, ids, cfg)
+}
+
+// TouchSession 更新会话的最后使用时间
+func (s *AuthService) TouchSession(sessionID uint) error {
+	if sessionID == 0 {
+		return nil
+	}
+	return database.GetDB().Model(&models.Session{}).
+		Where("id = ?", sessionID).
+		Update("last_used_at", time.Now()).Error
+}
+
+func (s *AuthService) issueTokens(tx *gorm.DB, userID, sessionID uint, familyID string, cfg *config.JWTConfig) (*TokenPair, error) {
+	var user models.User
+	if err := tx.Select("id", "status").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	unverified := user.Status == models.UserStatusPendingVerification
+	accessToken, err := middleware.GenerateSessionToken(userID, sessionID, unverified, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := utils.GenerateRandomString(64)
+	rt := &models.RefreshToken{
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenHash: utils.HashToken(refreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(time.Duration(cfg.RefreshExpireHour) * time.Hour),
+	}
+	if err := tx.Create(rt).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(middleware.AccessTokenTTL(cfg).Seconds()),
+		SessionID:    sessionID,
+	}, nil
+}
+
+// revokeSessions 吊销会话及其刷新token，并让已签发的access token立即失效
+func (s *AuthService) revokeSessions(userID uint, sessionIDs []uint, cfg *config.JWTConfig) ([]uint, error) {
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+
+	var revoked []uint
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND id IN ? AND revoked_at IS NULL", userID, sessionIDs).
+			Pluck("id", &revoked).Error; err != nil {
+			return err
+		}
+		if len(revoked) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.Session{}).
+			Where("id IN ?", revoked).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("session_id IN ? AND revoked_at IS NULL", revoked).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range revoked {
+		if err := cache.RevokeSession(context.Background(), id, middleware.AccessTokenTTL(cfg)); err != nil {
+			return revoked, err
+		}
+	}
+	return revoked, nil
+}
+
+// revokeFamily 吊销刷新token所在的家族，同时吊销家族所属的会话
+func (s *AuthService) revokeFamily(rt *models.RefreshToken, cfg *config.JWTConfig) error {
+	if err := database.GetDB().Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", rt.FamilyID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	_, err := s.revokeSessions(rt.UserID, []uint{rt.SessionID}, cfg)
+	return err
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n])
+}
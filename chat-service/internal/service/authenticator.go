@@ -0,0 +1,99 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	// ErrUnknownUser 该认证方式下不存在此用户，继续尝试下一个认证方式
+	ErrUnknownUser = errors.New("用户不存在")
+)
+
+// Authenticator 用户名密码认证方式，校验通过后返回对应的本地用户
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// NewAuthenticators 按auth.backends配置的顺序创建认证方式
+func NewAuthenticators(cfg *config.Config) ([]Authenticator, error) {
+	backends := cfg.Auth.Backends
+	if len(backends) == 0 {
+		backends = []string{"local"}
+	}
+
+	authenticators := make([]Authenticator, 0, len(backends))
+	for _, name := range backends {
+		switch name {
+		case "local":
+			authenticators = append(authenticators, NewLocalAuthenticator())
+		case "ldap":
+			ldap := NewLDAPAuthenticator(&cfg.LDAP)
+			ldap.auth = &cfg.Auth
+			authenticators = append(authenticators, ldap)
+		default:
+			return nil, fmt.Errorf("未知的认证方式: %s", name)
+		}
+	}
+	return authenticators, nil
+}
+
+// Authenticate 依次尝试配置的认证方式。某个方式返回ErrUnknownUser时继续尝试下一个，
+// 其他错误（包括密码错误）直接返回
+func Authenticate(cfg *config.Config, username, password string) (*models.User, error) {
+	authenticators, err := NewAuthenticators(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range authenticators {
+		user, err := a.Authenticate(username, password)
+		if errors.Is(err, ErrUnknownUser) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// LocalAuthenticator 使用本地数据库中的bcrypt密码认证
+type LocalAuthenticator struct{}
+
+func NewLocalAuthenticator() *LocalAuthenticator {
+	return &LocalAuthenticator{}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+func (a *LocalAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	var user models.User
+	err := database.GetDB().Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownUser
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 通过SSO或LDAP创建的用户没有本地密码
+	if user.Password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
@@ -5,9 +5,11 @@ import (
 	"chat-service/internal/models"
 	"chat-service/pkg/cache"
 	"context"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserService struct{}
@@ -16,6 +18,13 @@ type ChatService struct{}
 
 type MessageService struct{}
 
+var (
+	ErrMaxMembersTooSmall = errors.New("人数上限不能小于当前成员数")
+	ErrRoomArchived       = errors.New("房间已归档")
+	ErrRoomNotArchived    = errors.New("房间未归档")
+	ErrRoomFull           = errors.New("房间人数已满")
+)
+
 // 用户相关服务
 func NewUserService() *UserService {
 	return &UserService{}
@@ -47,10 +56,17 @@ func (s *UserService) UpdateUser(user *models.User) error {
 	return database.GetDB().Save(user).Error
 }
 
+// SetHideReadReceipts 设置是否向其他成员隐藏自己的已读和送达状态
+func (s *UserService) SetHideReadReceipts(userID uint, hide bool) error {
+	return database.GetDB().Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("hide_read_receipts", hide).Error
+}
+
 func (s *UserService) SearchUsers(query string) ([]models.User, error) {
 	var users []models.User
 	err := database.GetDB().
-		Where("username LIKE ? OR nickname LIKE ? OR email LIKE ?", 
+		Where("username LIKE ? OR nickname LIKE ? OR email LIKE ?",
 			"%"+query+"%", "%"+query+"%", "%"+query+"%").
 		Limit(20).
 		Find(&users).Error
@@ -62,7 +78,20 @@ func NewChatService() *ChatService {
 	return &ChatService{}
 }
 
+// CreateRoom 创建房间并添加成员，memberIDs会去重，数量不能超过房间的人数上限
 func (s *ChatService) CreateRoom(room *models.ChatRoom, memberIDs []uint) error {
+	seen := make(map[uint]bool, len(memberIDs))
+	uniqueIDs := make([]uint, 0, len(memberIDs))
+	for _, id := range memberIDs {
+		if !seen[id] {
+			seen[id] = true
+			uniqueIDs = append(uniqueIDs, id)
+		}
+	}
+	if room.MaxMembers > 0 && len(uniqueIDs) > room.MaxMembers {
+		return ErrRoomFull
+	}
+
 	return database.GetDB().Transaction(func(tx *gorm.DB) error {
 		// 创建聊天室
 		if err := tx.Create(room).Error; err != nil {
@@ -70,7 +99,7 @@ func (s *ChatService) CreateRoom(room *models.ChatRoom, memberIDs []uint) error
 		}
 
 		// 添加所有成员
-		for _, memberID := range memberIDs {
+		for _, memberID := range uniqueIDs {
 			member := &models.RoomMember{
 				RoomID:   room.ID,
 				UserID:   memberID,
@@ -96,7 +125,15 @@ func (s *ChatService) GetUserRooms(userID uint) ([]models.ChatRoom, error) {
 		Where("room_members.user_id = ? AND room_members.deleted_at IS NULL", userID).
 		Preload("Owner").
 		Find(&rooms).Error
-	return rooms, err
+	if err != nil {
+		return nil, err
+	}
+
+	ptrs := make([]*models.ChatRoom, len(rooms))
+	for i := range rooms {
+		ptrs[i] = &rooms[i]
+	}
+	return rooms, s.ResolveDMNames(userID, ptrs...)
 }
 
 func (s *ChatService) GetRoomByID(id uint) (*models.ChatRoom, error) {
@@ -112,24 +149,87 @@ func (s *ChatService) GetRoomByID(id uint) (*models.ChatRoom, error) {
 }
 
 func (s *ChatService) JoinRoom(userID, roomID uint) error {
-	// 检查用户是否已经是成员
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		_, err := joinRoom(tx, roomID, userID, models.RoomRoleMember)
+		return err
+	})
+}
+
+// lockRoom 在事务中锁定房间记录，串行化同一房间的并发加入
+func lockRoom(tx *gorm.DB, roomID uint) (*models.ChatRoom, error) {
+	var room models.ChatRoom
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&room, roomID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+	return &room, nil
+}
+
+// checkRoomCapacity 房间人数达到max_members时返回ErrRoomFull，需要先调用lockRoom。
+// 计数使用加锁读，事务中已有的快照不会导致漏数其他事务刚提交的成员
+func checkRoomCapacity(tx *gorm.DB, room *models.ChatRoom) error {
+	if room.MaxMembers <= 0 {
+		return nil
+	}
 	var count int64
-	database.GetDB().Model(&models.RoomMember{}).
-		Where("user_id = ? AND room_id = ?", userID, roomID).
-		Count(&count)
+	if err := tx.Model(&models.RoomMember{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("room_id = ?", room.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(room.MaxMembers) {
+		return ErrRoomFull
+	}
+	return nil
+}
+
+// joinRoom 在事务中将用户加入房间，离开或被移出的成员记录会被恢复。
+// 所有加入房间的途径都经过这里，房间人数达到上限时返回ErrRoomFull。
+// 返回值表示是否新加入，用户已是成员时返回false
+func joinRoom(tx *gorm.DB, roomID, userID uint, role string) (bool, error) {
+	// 先锁定房间，同一房间的加入操作串行执行
+	room, err := lockRoom(tx, roomID)
+	if err != nil {
+		return false, err
+	}
+
+	banned, err := isBanned(tx, roomID, userID)
+	if err != nil {
+		return false, err
+	}
+	if banned {
+		return false, ErrUserBanned
+	}
+
+	var member models.RoomMember
+	err = tx.Unscoped().Where("user_id = ? AND room_id = ?", userID, roomID).First(&member).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	if err == nil && !member.DeletedAt.Valid {
+		return false, nil // 已经是成员
+	}
+
+	if err := checkRoomCapacity(tx, room); err != nil {
+		return false, err
+	}
 
-	if count > 0 {
-		return nil // 已经是成员
+	if err == nil {
+		return true, tx.Unscoped().Model(&member).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"role":       role,
+			"joined_at":  time.Now(),
+		}).Error
 	}
 
-	member := &models.RoomMember{
+	member = models.RoomMember{
 		RoomID:   roomID,
 		UserID:   userID,
-		Role:     "member",
+		Role:     role,
 		JoinedAt: time.Now(),
 	}
-
-	return database.GetDB().Create(member).Error
+	return true, tx.Create(&member).Error
 }
 
 func (s *ChatService) LeaveRoom(userID, roomID uint) error {
@@ -146,6 +246,68 @@ func (s *ChatService) GetRoomMembers(roomID uint) ([]models.RoomMember, error) {
 	return members, err
 }
 
+// UpdateRoom 修改房间信息，updates的key为数据库列名
+func (s *ChatService) UpdateRoom(roomID uint, updates map[string]interface{}) (*models.ChatRoom, error) {
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var room models.ChatRoom
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&room, roomID).Error; err != nil {
+			return err
+		}
+
+		if maxMembers, ok := updates["max_members"].(int); ok {
+			var count int64
+			if err := tx.Model(&models.RoomMember{}).Where("room_id = ?", roomID).Count(&count).Error; err != nil {
+				return err
+			}
+			if int64(maxMembers) < count {
+				return ErrMaxMembersTooSmall
+			}
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&room).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRoomByID(roomID)
+}
+
+// SetArchived 归档或取消归档房间，归档后房间只读
+func (s *ChatService) SetArchived(roomID uint, archived bool) (*models.ChatRoom, error) {
+	query := database.GetDB().Model(&models.ChatRoom{}).Where("id = ?", roomID)
+	var result *gorm.DB
+	if archived {
+		result = query.Where("archived_at IS NULL").Update("archived_at", time.Now())
+	} else {
+		result = query.Where("archived_at IS NOT NULL").Update("archived_at", nil)
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if archived {
+			return nil, ErrRoomArchived
+		}
+		return nil, ErrRoomNotArchived
+	}
+	return s.GetRoomByID(roomID)
+}
+
+// DeleteRoom 软删除房间，成员和消息记录保留
+func (s *ChatService) DeleteRoom(roomID uint) error {
+	result := database.GetDB().Delete(&models.ChatRoom{}, roomID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoomNotFound
+	}
+	return nil
+}
+
 // 消息相关服务
 func NewMessageService() *MessageService {
 	return &MessageService{}
@@ -155,19 +317,31 @@ func (s *MessageService) CreateMessage(message *models.Message) error {
 	return database.GetDB().Create(message).Error
 }
 
-func (s *MessageService) GetRoomMessages(roomID uint, page, pageSize int) ([]models.Message, error) {
+// GetRoomMessages 分页获取房间消息，不包括用户仅为自己删除的消息。为所有人删除的消息保留位置但不返回内容，
+// 其他消息附带按表情汇总的回应
+func (s *MessageService) GetRoomMessages(roomID, userID uint, page, pageSize int) ([]models.Message, error) {
 	var messages []models.Message
 	offset := (page - 1) * pageSize
 
 	err := database.GetDB().
 		Preload("Sender").
-		Where("room_id = ? AND is_deleted = false", roomID).
+		Where("room_id = ?", roomID).
+		Where("NOT EXISTS (SELECT 1 FROM hidden_messages WHERE hidden_messages.message_id = messages.id AND hidden_messages.user_id = ?)", userID).
 		Order("created_at DESC").
 		Limit(pageSize).
 		Offset(offset).
 		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
 
-	return messages, err
+	for i := range messages {
+		scrubDeleted(&messages[i])
+	}
+	if err := s.attachReactions(messages, userID); err != nil {
+		return nil, err
+	}
+	return messages, nil
 }
 
 func (s *MessageService) GetMessageByID(id uint) (*models.Message, error) {
@@ -182,12 +356,62 @@ func (s *MessageService) GetMessageByID(id uint) (*models.Message, error) {
 	return &message, nil
 }
 
-func (s *MessageService) DeleteMessage(id uint) error {
-	return database.GetDB().Model(&models.Message{}).
-		Where("id = ?", id).
-		Update("is_deleted", true).Error
+// DeleteMessage 为所有人删除消息，清除内容、编辑历史和表情回应。删除话题中的回复时返回更新了回复数的话题第一条消息
+func (s *MessageService) DeleteMessage(id uint) (*models.Message, error) {
+	var root *models.Message
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var message models.Message
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND is_deleted = false", id).
+			First(&message).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&message).Updates(map[string]interface{}{
+			"is_deleted": true,
+			"content":    "",
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", id).Delete(&models.MessageEdit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", id).Delete(&models.MessageReaction{}).Error; err != nil {
+			return err
+		}
+
+		if message.ReplyToID == nil {
+			return nil
+		}
+		root = &models.Message{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(root, *message.ReplyToID).Error; err != nil {
+			return err
+		}
+		if root.ReplyCount > 0 {
+			root.ReplyCount--
+		}
+		return tx.Model(root).Update("reply_count", root.ReplyCount).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	removeFromIndex(id)
+	return root, nil
 }
 
+// HideMessage 仅为自己删除消息，其他成员不受影响
+func (s *MessageService) HideMessage(messageID, userID uint) error {
+	return database.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&models.HiddenMessage{
+		UserID:    userID,
+		MessageID: messageID,
+	}).Error
+}
+
+// GetUnreadCount 统计用户在房间中最后阅读之后的未读消息数，不包括用户仅为自己删除的消息
 func (s *MessageService) GetUnreadCount(userID, roomID uint) (int64, error) {
 	var count int64
 
@@ -201,22 +425,40 @@ func (s *MessageService) GetUnreadCount(userID, roomID uint) (int64, error) {
 	database.GetDB().Model(&models.Message{}).
 		Where("room_id = ? AND sender_id != ? AND is_deleted = false AND created_at > ?",
 			roomID, userID, lastRead).
+		Where("NOT EXISTS (SELECT 1 FROM hidden_messages WHERE hidden_messages.message_id = messages.id AND hidden_messages.user_id = ?)", userID).
 		Count(&count)
 
 	return count, nil
 }
 
-func (s *MessageService) MarkAsRead(userID, roomID uint) error {
-	return database.GetDB().Model(&models.RoomMember{}).
+// MarkAsRead 将房间标记为全部已读，已读回执位置同时移到房间最新的消息
+func (s *MessageService) MarkAsRead(userID, roomID uint) (*ReadReceipt, error) {
+	err := database.GetDB().Model(&models.RoomMember{}).
 		Where("user_id = ? AND room_id = ?", userID, roomID).
 		Update("last_read", time.Now()).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var latestID uint
+	if err := database.GetDB().Model(&models.Message{}).
+		Where("room_id = ?", roomID).
+		Select("COALESCE(MAX(id), 0)").
+		Scan(&latestID).Error; err != nil {
+		return nil, err
+	}
+	if latestID == 0 {
+		return nil, nil
+	}
+	return s.AckMessage(userID, roomID, latestID, models.ReceiptRead)
 }
 
 func (s *MessageService) GetRoomsWithUnread(userID uint) ([]map[string]interface{}, error) {
 	type RoomWithUnread struct {
 		models.ChatRoom
-		UnreadCount int64           `json:"unread_count"`
-		LastMessage *models.Message `json:"last_message,omitempty"`
+		UnreadCount  int64           `json:"unread_count"`
+		MentionCount int64           `json:"mention_count"`
+		LastMessage  *models.Message `json:"last_message,omitempty"`
 	}
 
 	var results []RoomWithUnread
@@ -231,11 +473,25 @@ func (s *MessageService) GetRoomsWithUnread(userID uint) ([]map[string]interface
 				WHERE messages.room_id = chat_rooms.id 
 				AND messages.sender_id != ? 
 				AND messages.is_deleted = false 
+				AND NOT EXISTS (SELECT 1 FROM hidden_messages WHERE hidden_messages.message_id = messages.id AND hidden_messages.user_id = ?)
 				AND messages.created_at > COALESCE(
 					(SELECT last_read FROM room_members WHERE user_id = ? AND room_id = chat_rooms.id),
 					'1970-01-01'
 				)
 			) as unread_count,
+			(
+				SELECT COUNT(*)
+				FROM message_mentions
+				JOIN messages ON messages.id = message_mentions.message_id
+				WHERE message_mentions.room_id = chat_rooms.id
+				AND message_mentions.user_id = ?
+				AND messages.is_deleted = false
+				AND NOT EXISTS (SELECT 1 FROM hidden_messages WHERE hidden_messages.message_id = messages.id AND hidden_messages.user_id = ?)
+				AND message_mentions.created_at > COALESCE(
+					(SELECT last_read FROM room_members WHERE user_id = ? AND room_id = chat_rooms.id),
+					'1970-01-01'
+				)
+			) as mention_count,
 			(
 				SELECT * 
 				FROM messages 
@@ -244,9 +500,9 @@ func (s *MessageService) GetRoomsWithUnread(userID uint) ([]map[string]interface
 				ORDER BY created_at DESC 
 				LIMIT 1
 			) as last_message
-		`, userID, userID).
+		`, userID, userID, userID, userID, userID, userID).
 		Joins("JOIN room_members ON chat_rooms.id = room_members.room_id").
-		Where("room_members.user_id = ?", userID).
+		Where("room_members.user_id = ? AND room_members.deleted_at IS NULL AND chat_rooms.deleted_at IS NULL", userID).
 		Preload("LastMessage.Sender").
 		Find(&results).Error
 
@@ -254,21 +510,32 @@ func (s *MessageService) GetRoomsWithUnread(userID uint) ([]map[string]interface
 		return nil, err
 	}
 
+	ptrs := make([]*models.ChatRoom, len(results))
+	for i := range results {
+		ptrs[i] = &results[i].ChatRoom
+	}
+	if err := NewChatService().ResolveDMNames(userID, ptrs...); err != nil {
+		return nil, err
+	}
+
 	// 转换为map格式
 	var rooms []map[string]interface{}
 	for _, result := range results {
 		room := map[string]interface{}{
-			"id":           result.ID,
-			"name":         result.Name,
-			"description":  result.Description,
-			"type":         result.Type,
-			"avatar":       result.Avatar,
-			"owner_id":     result.OwnerID,
-			"max_members":  result.MaxMembers,
-			"created_at":   result.CreatedAt,
-			"updated_at":   result.UpdatedAt,
-			"unread_count": result.UnreadCount,
-			"last_message": result.LastMessage,
+			"id":            result.ID,
+			"name":          result.Name,
+			"description":   result.Description,
+			"type":          result.Type,
+			"avatar":        result.Avatar,
+			"owner_id":      result.OwnerID,
+			"max_members":   result.MaxMembers,
+			"visibility":    result.Visibility,
+			"archived_at":   result.ArchivedAt,
+			"created_at":    result.CreatedAt,
+			"updated_at":    result.UpdatedAt,
+			"unread_count":  result.UnreadCount,
+			"mention_count": result.MentionCount,
+			"last_message":  result.LastMessage,
 		}
 		rooms = append(rooms, room)
 	}
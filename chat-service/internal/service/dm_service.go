@@ -0,0 +1,142 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var ErrDMUserNotFound = errors.New("对方用户不存在")
+
+// GetOrCreateDM 获取两个用户之间的单聊，不存在时创建。返回值created表示是否新建。
+// 离开过单聊的一方会重新加入
+func (s *ChatService) GetOrCreateDM(userID, otherID uint) (*models.ChatRoom, bool, error) {
+	if userID == otherID {
+		return nil, false, ErrCannotTargetSelf
+	}
+	if err := database.GetDB().Select("id").First(&models.User{}, otherID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, ErrDMUserNotFound
+		}
+		return nil, false, err
+	}
+
+	key := dmKey(userID, otherID)
+	room, err := s.openDM(key, userID, otherID)
+	if err == nil {
+		return room, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	room = &models.ChatRoom{
+		Type:       "single",
+		OwnerID:    userID,
+		MaxMembers: 2,
+		Visibility: models.RoomVisibilityInviteOnly,
+		DMKey:      &key,
+	}
+	if err := s.CreateRoom(room, []uint{userID, otherID}); err != nil {
+		// 双方同时发起时唯一索引冲突，使用对方创建的房间
+		if existing, findErr := s.openDM(key, userID, otherID); findErr == nil {
+			return existing, false, nil
+		}
+		return nil, false, err
+	}
+	return room, true, nil
+}
+
+// openDM 查找已有的单聊并确保双方都是成员，不存在时返回gorm.ErrRecordNotFound
+func (s *ChatService) openDM(key string, userID, otherID uint) (*models.ChatRoom, error) {
+	var room models.ChatRoom
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("dm_key = ?", key).First(&room).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = claimLegacyDM(tx, key, userID, otherID, &room)
+		}
+		if err != nil {
+			return err
+		}
+		for _, id := range []uint{userID, otherID} {
+			if _, err := joinRoom(tx, room.ID, id, models.RoomRoleMember); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// claimLegacyDM 按成员关系查找dm_key上线前创建的单聊并补上dm_key，之后直接按dm_key命中。
+// 离开过单聊的成员记录仍然保留，因此不过滤deleted_at
+func claimLegacyDM(tx *gorm.DB, key string, userID, otherID uint, room *models.ChatRoom) error {
+	err := tx.Where("type = ? AND dm_key IS NULL", "single").
+		Where("EXISTS (SELECT 1 FROM room_members WHERE room_members.room_id = chat_rooms.id AND room_members.user_id = ?)", userID).
+		Where("EXISTS (SELECT 1 FROM room_members WHERE room_members.room_id = chat_rooms.id AND room_members.user_id = ?)", otherID).
+		Order("id").First(room).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(room).Update("dm_key", key).Error
+}
+
+// ResolveDMNames 单聊没有固定的名称，按当前用户看到的对方昵称和头像填充Name和Avatar
+func (s *ChatService) ResolveDMNames(userID uint, rooms ...*models.ChatRoom) error {
+	roomIDs := make([]uint, 0, len(rooms))
+	for _, room := range rooms {
+		if room.Type == "single" {
+			roomIDs = append(roomIDs, room.ID)
+		}
+	}
+	if len(roomIDs) == 0 {
+		return nil
+	}
+
+	// 对方离开单聊后仍然显示其昵称
+	var counterparts []struct {
+		RoomID   uint
+		Username string
+		Nickname string
+		Avatar   string
+	}
+	err := database.GetDB().Table("room_members").
+		Select("room_members.room_id, users.username, users.nickname, users.avatar").
+		Joins("JOIN users ON users.id = room_members.user_id").
+		Where("room_members.room_id IN ? AND room_members.user_id != ?", roomIDs, userID).
+		Scan(&counterparts).Error
+	if err != nil {
+		return err
+	}
+
+	byRoom := make(map[uint]int, len(counterparts))
+	for i, c := range counterparts {
+		byRoom[c.RoomID] = i
+	}
+	for _, room := range rooms {
+		i, ok := byRoom[room.ID]
+		if room.Type != "single" || !ok {
+			continue
+		}
+		room.Name = counterparts[i].Nickname
+		if room.Name == "" {
+			room.Name = counterparts[i].Username
+		}
+		room.Avatar = counterparts[i].Avatar
+	}
+	return nil
+}
+
+// dmKey 两个用户的单聊标识，与发起方无关
+func dmKey(a, b uint) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%d:%d", a, b)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"chat-service/pkg/utils"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const inviteCodeLength = 16
+
+var (
+	ErrInviteNotFound  = errors.New("邀请码不存在或已失效")
+	ErrInviteExpired   = errors.New("邀请码已过期")
+	ErrInviteExhausted = errors.New("邀请码使用次数已达上限")
+)
+
+// InvitePreview 邀请码的公开预览信息，未登录用户也可以查看
+type InvitePreview struct {
+	Code        string     `json:"code"`
+	RoomID      uint       `json:"room_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Avatar      string     `json:"avatar"`
+	MemberCount int64      `json:"member_count"`
+	MaxMembers  int        `json:"max_members"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// InviteService 房间邀请码的创建、预览、使用和吊销
+type InviteService struct{}
+
+func NewInviteService() *InviteService {
+	return &InviteService{}
+}
+
+// CreateInvite 创建邀请码，maxUses为0表示不限次数，expiresAt为nil表示永不过期
+func (s *InviteService) CreateInvite(roomID, creatorID uint, role string, maxUses int, expiresAt *time.Time) (*models.RoomInvite, error) {
+	if role != models.RoomRoleAdmin && role != models.RoomRoleMember {
+		return nil, ErrInvalidRole
+	}
+
+	invite := &models.RoomInvite{
+		RoomID:    roomID,
+		Code:      utils.GenerateRandomString(inviteCodeLength),
+		CreatedBy: creatorID,
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+	}
+	if err := database.GetDB().Create(invite).Error; err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// GetInvites 获取房间仍然有效的邀请码
+func (s *InviteService) GetInvites(roomID uint) ([]models.RoomInvite, error) {
+	var invites []models.RoomInvite
+	err := database.GetDB().Preload("Creator").
+		Where("room_id = ? AND revoked_at IS NULL", roomID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Where("max_uses = 0 OR uses < max_uses").
+		Order("created_at DESC").Find(&invites).Error
+	return invites, err
+}
+
+// RevokeInvite 吊销邀请码，吊销后立即失效
+func (s *InviteService) RevokeInvite(roomID, inviteID uint) error {
+	result := database.GetDB().Model(&models.RoomInvite{}).
+		Where("id = ? AND room_id = ? AND revoked_at IS NULL", inviteID, roomID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// GetPreview 获取邀请码对应房间的名称和成员数
+func (s *InviteService) GetPreview(code string) (*InvitePreview, error) {
+	db := database.GetDB()
+	invite, room, err := loadInvite(db, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := db.Model(&models.RoomMember{}).Where("room_id = ?", room.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+
+	return &InvitePreview{
+		Code:        invite.Code,
+		RoomID:      room.ID,
+		Name:        room.Name,
+		Description: room.Description,
+		Avatar:      room.Avatar,
+		MemberCount: count,
+		MaxMembers:  room.MaxMembers,
+		ExpiresAt:   invite.ExpiresAt,
+	}, nil
+}
+
+// RedeemInvite 使用邀请码加入房间。用户已是成员时不消耗使用次数，返回的消息为nil
+func (s *InviteService) RedeemInvite(code string, userID uint) (*models.ChatRoom, *models.Message, error) {
+	var room *models.ChatRoom
+	var msg *models.Message
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		invite, r, err := loadInvite(tx, code)
+		if err != nil {
+			return err
+		}
+		room = r
+		if room.ArchivedAt != nil {
+			return ErrRoomArchived
+		}
+
+		joined, err := joinRoom(tx, room.ID, userID, invite.Role)
+		if err != nil || !joined {
+			return err
+		}
+
+		result := tx.Model(&models.RoomInvite{}).
+			Where("id = ? AND (max_uses = 0 OR uses < max_uses)", invite.ID).
+			Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInviteExhausted
+		}
+
+		msg, err = createSystemMessage(tx, room.ID, userID, "%s 通过邀请链接加入了群聊", userID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return room, msg, nil
+}
+
+// loadInvite 加载邀请码及其房间，邀请码被吊销、过期、用完或房间已删除时返回错误
+func loadInvite(tx *gorm.DB, code string) (*models.RoomInvite, *models.ChatRoom, error) {
+	var invite models.RoomInvite
+	if err := tx.Where("code = ? AND revoked_at IS NULL", code).First(&invite).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInviteNotFound
+		}
+		return nil, nil, err
+	}
+	if invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt) {
+		return nil, nil, ErrInviteExpired
+	}
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
+		return nil, nil, ErrInviteExhausted
+	}
+
+	var room models.ChatRoom
+	if err := tx.First(&room, invite.RoomID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInviteNotFound
+		}
+		return nil, nil, err
+	}
+	return &invite, &room, nil
+}
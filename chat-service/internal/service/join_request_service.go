@@ -0,0 +1,202 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrJoinRequestPending  = errors.New("已提交加入申请，请等待审核")
+	ErrJoinRequestNotFound = errors.New("加入申请不存在或已处理")
+)
+
+// PublicRoom 公开目录中的房间
+type PublicRoom struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Avatar      string    `json:"avatar"`
+	Visibility  string    `json:"visibility"`
+	MemberCount int64     `json:"member_count"`
+	MaxMembers  int       `json:"max_members"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// JoinRequestService 公开房间目录和加入申请的审核
+type JoinRequestService struct{}
+
+func NewJoinRequestService() *JoinRequestService {
+	return &JoinRequestService{}
+}
+
+// GetPublicRooms 分页搜索公开和可申请加入的群聊，已归档的房间不显示
+func (s *JoinRequestService) GetPublicRooms(query string, page, pageSize int) ([]PublicRoom, int64, error) {
+	db := database.GetDB().Model(&models.ChatRoom{}).
+		Where("type = ? AND visibility IN ? AND archived_at IS NULL", "group",
+			[]string{models.RoomVisibilityPublic, models.RoomVisibilityRequestToJoin})
+	if query = strings.TrimSpace(query); query != "" {
+		like := "%" + escapeLike(query) + "%"
+		db = db.Where("name LIKE ? OR description LIKE ?", like, like)
+	}
+	// 统计总数和查询分页共用同一组条件
+	db = db.Session(&gorm.Session{})
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rooms []PublicRoom
+	err := db.Select(`chat_rooms.id, chat_rooms.name, chat_rooms.description, chat_rooms.avatar,
+			chat_rooms.visibility, chat_rooms.max_members, chat_rooms.created_at,
+			(SELECT COUNT(*) FROM room_members WHERE room_members.room_id = chat_rooms.id
+				AND room_members.deleted_at IS NULL) AS member_count`).
+		Order("member_count DESC, chat_rooms.id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).
+		Scan(&rooms).Error
+	return rooms, total, err
+}
+
+// escapeLike 转义LIKE中的通配符，搜索词按字面匹配
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// CreateRequest 提交加入申请，同一房间只能有一个待审核的申请
+func (s *JoinRequestService) CreateRequest(roomID, userID uint, message string) (*models.RoomJoinRequest, error) {
+	request := &models.RoomJoinRequest{
+		RoomID:  roomID,
+		UserID:  userID,
+		Message: message,
+		Status:  models.JoinRequestPending,
+	}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if _, err := lockRoom(tx, roomID); err != nil {
+			return err
+		}
+
+		banned, err := isBanned(tx, roomID, userID)
+		if err != nil {
+			return err
+		}
+		if banned {
+			return ErrUserBanned
+		}
+
+		var count int64
+		if err := tx.Model(&models.RoomJoinRequest{}).
+			Where("room_id = ? AND user_id = ? AND status = ?", roomID, userID, models.JoinRequestPending).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrJoinRequestPending
+		}
+		return tx.Create(request).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// GetRequests 分页获取房间的加入申请，status为空时返回全部
+func (s *JoinRequestService) GetRequests(roomID uint, status string, page, pageSize int) ([]models.RoomJoinRequest, error) {
+	db := database.GetDB().Preload("User").Where("room_id = ?", roomID)
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+
+	var requests []models.RoomJoinRequest
+	err := db.Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&requests).Error
+	return requests, err
+}
+
+// ApproveRequest 同意加入申请并将申请人加入房间
+func (s *JoinRequestService) ApproveRequest(roomID, requestID, reviewerID uint) (*models.RoomJoinRequest, *models.Message, error) {
+	var request models.RoomJoinRequest
+	var msg *models.Message
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 与提交申请保持相同的加锁顺序，先锁房间再锁申请
+		room, err := lockRoom(tx, roomID)
+		if err != nil {
+			return err
+		}
+		if room.ArchivedAt != nil {
+			return ErrRoomArchived
+		}
+		if err := loadPendingRequest(tx, roomID, requestID, &request); err != nil {
+			return err
+		}
+
+		joined, err := joinRoom(tx, roomID, request.UserID, models.RoomRoleMember)
+		if err != nil {
+			return err
+		}
+		if err := reviewRequest(tx, &request, models.JoinRequestApproved, reviewerID); err != nil {
+			return err
+		}
+
+		// 申请期间已通过其他方式加入时不再生成系统消息
+		if joined {
+			msg, err = createSystemMessage(tx, roomID, reviewerID, "%s 同意了 %s 的加入申请", reviewerID, request.UserID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &request, msg, nil
+}
+
+// RejectRequest 拒绝加入申请
+func (s *JoinRequestService) RejectRequest(roomID, requestID, reviewerID uint) (*models.RoomJoinRequest, error) {
+	var request models.RoomJoinRequest
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := loadPendingRequest(tx, roomID, requestID, &request); err != nil {
+			return err
+		}
+		return reviewRequest(tx, &request, models.JoinRequestRejected, reviewerID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetReviewerIDs 获取可以审核加入申请的群主和管理员
+func (s *JoinRequestService) GetReviewerIDs(roomID uint) ([]uint, error) {
+	var userIDs []uint
+	err := database.GetDB().Model(&models.RoomMember{}).
+		Where("room_id = ? AND role IN ?", roomID, []string{models.RoomRoleOwner, models.RoomRoleAdmin}).
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+func loadPendingRequest(tx *gorm.DB, roomID, requestID uint, request *models.RoomJoinRequest) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND room_id = ? AND status = ?", requestID, roomID, models.JoinRequestPending).
+		First(request).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrJoinRequestNotFound
+	}
+	return err
+}
+
+func reviewRequest(tx *gorm.DB, request *models.RoomJoinRequest, status string, reviewerID uint) error {
+	now := time.Now()
+	request.Status = status
+	request.ReviewedBy = &reviewerID
+	request.ReviewedAt = &now
+	return tx.Model(request).Updates(map[string]interface{}{
+		"status":      status,
+		"reviewed_by": reviewerID,
+		"reviewed_at": now,
+	}).Error
+}
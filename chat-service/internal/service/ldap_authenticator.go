@@ -0,0 +1,314 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// ldapProvider LDAP账号在user_identities中的provider，subject为用户条目的DN
+const ldapProvider = "ldap"
+
+var (
+	ErrLDAPAccountNotFound = errors.New("该目录账号尚未开通")
+	ErrLDAPAmbiguousUser   = errors.New("LDAP中匹配到多个用户")
+	ErrLDAPUnavailable     = errors.New("LDAP服务不可用")
+	ErrLDAPEmailInUse      = errors.New("该目录账号的邮箱已被本地账号使用，请联系管理员关联账号")
+	ErrIdentityLinked      = errors.New("该目录账号已关联其他用户")
+)
+
+// ldapAccount 从目录中读取的用户信息
+type ldapAccount struct {
+	DN     string
+	Email  string
+	Name   string
+	Groups []string
+	Role   string // 未配置组映射时为空，表示不同步角色
+}
+
+// LDAPAuthenticator 先用服务账号查找用户条目，再用用户的DN和密码绑定完成认证
+type LDAPAuthenticator struct {
+	cfg  *config.LDAPConfig
+	auth *config.AuthConfig // 为空时不回收过期未验证注册占用的邮箱
+}
+
+func NewLDAPAuthenticator(cfg *config.LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{cfg: cfg}
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return ldapProvider
+}
+
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	account, err := a.verify(username, password)
+	if errors.Is(err, ErrLDAPUnavailable) && a.cfg.FallbackToLocal {
+		// 只有设置过本地密码的用户可以登录，目录创建的用户没有本地密码
+		log.Printf("%v，改用本地密码校验", err)
+		return NewLocalAuthenticator().Authenticate(username, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.syncUser(username, account)
+}
+
+// verify 在目录中校验用户名密码，不访问本地数据库
+func (a *LDAPAuthenticator) verify(username, password string) (*ldapAccount, error) {
+	// 空密码绑定在LDAP中是匿名绑定，会被当作成功
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: 服务账号绑定失败: %v", ErrLDAPUnavailable, err)
+		}
+	}
+
+	attributes := []string{"dn"}
+	for _, attr := range []string{a.cfg.EmailAttribute, a.cfg.NameAttribute, a.cfg.GroupAttribute} {
+		if attr != "" {
+			attributes = append(attributes, attr)
+		}
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrLDAPAmbiguousUser
+		}
+		return nil, fmt.Errorf("%w: 查找用户失败: %v", ErrLDAPUnavailable, err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrUnknownUser
+	case 1:
+	default:
+		return nil, ErrLDAPAmbiguousUser
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: 用户绑定失败: %v", ErrLDAPUnavailable, err)
+	}
+
+	account := &ldapAccount{
+		DN:    entry.DN,
+		Email: entry.GetAttributeValue(a.cfg.EmailAttribute),
+		Name:  entry.GetAttributeValue(a.cfg.NameAttribute),
+	}
+	if a.cfg.GroupAttribute != "" {
+		account.Groups = entry.GetAttributeValues(a.cfg.GroupAttribute)
+	}
+	account.Role = a.mapRole(account.Groups)
+	return account, nil
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(a.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的LDAP地址: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: a.cfg.InsecureSkipVerify,
+	}
+
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 连接失败: %v", ErrLDAPUnavailable, err)
+	}
+	conn.SetTimeout(10 * time.Second)
+
+	if a.cfg.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: StartTLS失败: %v", ErrLDAPUnavailable, err)
+		}
+	}
+	return conn, nil
+}
+
+// mapRole 按group_roles的顺序取第一个匹配的组对应的角色，都不匹配时为普通用户。
+// 映射为admin的组还必须列在admin_groups中，否则忽略该映射
+func (a *LDAPAuthenticator) mapRole(groups []string) string {
+	if len(a.cfg.GroupRoles) == 0 {
+		return ""
+	}
+	for _, mapping := range a.cfg.GroupRoles {
+		if mapping.Role == models.UserRoleAdmin && !containsGroup(a.cfg.AdminGroups, mapping.Group) {
+			continue
+		}
+		if containsGroup(groups, mapping.Group) {
+			return mapping.Role
+		}
+	}
+	return models.UserRoleUser
+}
+
+// containsGroup 组DN比较时忽略大小写和首尾空白
+func containsGroup(groups []string, group string) bool {
+	for _, g := range groups {
+		if strings.EqualFold(strings.TrimSpace(g), strings.TrimSpace(group)) {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkLDAPIdentity 由管理员将目录账号（用户条目的DN）关联到已有的本地用户，之后该目录账号登录即为该用户
+func LinkLDAPIdentity(userID uint, dn string) error {
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id", "email").First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", ldapProvider, dn).First(&identity).Error
+		if err == nil {
+			if identity.UserID == userID {
+				return nil
+			}
+			return ErrIdentityLinked
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   userID,
+			Provider: ldapProvider,
+			Subject:  dn,
+			Email:    user.Email,
+		}).Error
+	})
+}
+
+// syncUser 将目录账号映射为本地用户：只按已关联的DN查找，没有关联时在允许时自动创建。
+// 不按邮箱关联已有账号，否则能修改目录条目邮箱的人就能登录同邮箱的本地账号，已有账号需由管理员关联。
+// 每次登录都会把昵称、邮箱和角色同步为目录中的值
+func (a *LDAPAuthenticator) syncUser(username string, account *ldapAccount) (*models.User, error) {
+	var user models.User
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", ldapProvider, account.DN).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			return a.updateAttributes(tx, &user, account)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if !a.cfg.AutoProvision {
+			return ErrLDAPAccountNotFound
+		}
+		if err := a.provisionUser(tx, &user, username, account); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: ldapProvider,
+			Subject:  account.DN,
+			Email:    account.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (a *LDAPAuthenticator) provisionUser(tx *gorm.DB, user *models.User, username string, account *ldapAccount) error {
+	if account.Email != "" {
+		err := releaseEmail(tx, account.Email, 0, a.auth)
+		if errors.Is(err, ErrEmailInUse) {
+			return ErrLDAPEmailInUse
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	localName, err := uniqueUsername(tx, username)
+	if err != nil {
+		return err
+	}
+
+	nickname := account.Name
+	if nickname == "" {
+		nickname = localName
+	}
+	role := account.Role
+	if role == "" {
+		role = models.UserRoleUser
+	}
+
+	// 目录账号没有本地密码，密码始终由LDAP校验
+	*user = models.User{
+		Username: localName,
+		Nickname: nickname,
+		Email:    account.Email,
+		Status:   models.UserStatusActive,
+		Role:     role,
+	}
+	return tx.Create(user).Error
+}
+
+func (a *LDAPAuthenticator) updateAttributes(tx *gorm.DB, user *models.User, account *ldapAccount) error {
+	updates := map[string]interface{}{}
+	if account.Name != "" && account.Name != user.Nickname {
+		updates["nickname"] = account.Name
+	}
+	// 目录不能授予管理员时也不会撤销本地设置的管理员
+	if account.Role != "" && account.Role != user.Role &&
+		(user.Role != models.UserRoleAdmin || len(a.cfg.AdminGroups) > 0) {
+		updates["role"] = account.Role
+	}
+	// 目录中的邮箱视为已验证
+	if user.Status == models.UserStatusPendingVerification {
+		updates["status"] = models.UserStatusActive
+	}
+	if account.Email != "" && account.Email != user.Email {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("email = ? AND id <> ?", account.Email, user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			updates["email"] = account.Email
+		} else {
+			log.Printf("LDAP邮箱 %s 已被其他用户使用，跳过同步", account.Email)
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(user).Updates(updates).Error
+}
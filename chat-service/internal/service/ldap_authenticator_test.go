@@ -0,0 +1,263 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/models"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLDAPEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// testLDAPServer 只实现Bind、Search和Unbind的进程内LDAP服务，用于测试认证流程
+type testLDAPServer struct {
+	listener net.Listener
+	entries  []testLDAPEntry
+	service  testLDAPEntry
+}
+
+func newTestLDAPServer(t *testing.T) *testLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &testLDAPServer{
+		listener: listener,
+		service:  testLDAPEntry{dn: "cn=readonly,dc=example,dc=com", password: "readonly"},
+		entries: []testLDAPEntry{
+			{
+				dn:       "uid=alice,ou=people,dc=example,dc=com",
+				password: "alice-secret",
+				attributes: map[string][]string{
+					"uid":         {"alice"},
+					"mail":        {"alice@example.com"},
+					"displayName": {"Alice Liddell"},
+					"memberOf":    {"CN=Chat-Admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+				},
+			},
+			{
+				dn:       "uid=bob,ou=people,dc=example,dc=com",
+				password: "bob-secret",
+				attributes: map[string][]string{
+					"uid":         {"bob"},
+					"mail":        {"bob@example.com"},
+					"displayName": {"Bob"},
+					"memberOf":    {"cn=staff,ou=groups,dc=example,dc=com"},
+				},
+			},
+		},
+	}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			for _, e := range append([]testLDAPEntry{s.service}, s.entries...) {
+				if e.dn == dn && e.password == password && password != "" {
+					code = ldap.LDAPResultSuccess
+					boundDN = dn
+				}
+			}
+			conn.Write(ldapResponse(messageID, ldap.ApplicationBindResponse, code).Bytes())
+
+		case ldap.ApplicationSearchRequest:
+			if boundDN != s.service.dn {
+				conn.Write(ldapResponse(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			for _, e := range s.entries {
+				if filter == fmt.Sprintf("(uid=%s)", e.attributes["uid"][0]) {
+					conn.Write(ldapEntry(messageID, e).Bytes())
+				}
+			}
+			conn.Write(ldapResponse(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func ldapEnvelope(messageID int64, op *ber.Packet) *ber.Packet {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, ""))
+	envelope.AppendChild(op)
+	return envelope
+}
+
+func ldapResponse(messageID int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return ldapEnvelope(messageID, op)
+}
+
+func ldapEntry(messageID int64, e testLDAPEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range e.attributes {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attributes.AppendChild(attr)
+	}
+	op.AppendChild(attributes)
+	return ldapEnvelope(messageID, op)
+}
+
+func testLDAPConfig(url string) *config.LDAPConfig {
+	return &config.LDAPConfig{
+		URL:            url,
+		BindDN:         "cn=readonly,dc=example,dc=com",
+		BindPassword:   "readonly",
+		BaseDN:         "ou=people,dc=example,dc=com",
+		UserFilter:     "(uid=%s)",
+		EmailAttribute: "mail",
+		NameAttribute:  "displayName",
+		GroupAttribute: "memberOf",
+		GroupRoles: []config.LDAPGroupRole{
+			{Group: "cn=chat-admins,ou=groups,dc=example,dc=com", Role: models.UserRoleAdmin},
+		},
+	}
+}
+
+func TestLDAPVerify(t *testing.T) {
+	server := newTestLDAPServer(t)
+	a := NewLDAPAuthenticator(testLDAPConfig(server.URL()))
+
+	account, err := a.verify("alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "uid=alice,ou=people,dc=example,dc=com", account.DN)
+	assert.Equal(t, "alice@example.com", account.Email)
+	assert.Equal(t, "Alice Liddell", account.Name)
+	assert.Equal(t, models.UserRoleUser, account.Role)
+
+	account, err = a.verify("bob", "bob-secret")
+	require.NoError(t, err)
+	assert.Equal(t, models.UserRoleUser, account.Role)
+}
+
+func TestLDAPMapRoleRequiresAdminGroups(t *testing.T) {
+	cfg := testLDAPConfig("ldap://127.0.0.1")
+	groups := []string{"CN=Chat-Admins,ou=groups,dc=example,dc=com"}
+
+	// 只在group_roles中映射为admin不会授予管理员
+	assert.Equal(t, models.UserRoleUser, NewLDAPAuthenticator(cfg).mapRole(groups))
+
+	cfg.AdminGroups = []string{"cn=chat-admins,ou=groups,dc=example,dc=com"}
+	assert.Equal(t, models.UserRoleAdmin, NewLDAPAuthenticator(cfg).mapRole(groups))
+}
+
+func TestLDAPVerifyRejectsBadCredentials(t *testing.T) {
+	server := newTestLDAPServer(t)
+	a := NewLDAPAuthenticator(testLDAPConfig(server.URL()))
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     error
+	}{
+		{"错误密码", "alice", "wrong", ErrInvalidCredentials},
+		{"空密码", "alice", "", ErrInvalidCredentials},
+		{"用户不存在", "carol", "secret", ErrUnknownUser},
+		{"过滤器注入", "*", "alice-secret", ErrUnknownUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.verify(tt.username, tt.password)
+			assert.True(t, errors.Is(err, tt.want), "got %v", err)
+		})
+	}
+}
+
+func TestLDAPVerifyServiceBindFailure(t *testing.T) {
+	server := newTestLDAPServer(t)
+	cfg := testLDAPConfig(server.URL())
+	cfg.BindPassword = "wrong"
+
+	_, err := NewLDAPAuthenticator(cfg).verify("alice", "alice-secret")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrLDAPUnavailable))
+	assert.False(t, errors.Is(err, ErrInvalidCredentials))
+	assert.False(t, errors.Is(err, ErrUnknownUser))
+}
+
+func TestLDAPVerifyServerDown(t *testing.T) {
+	server := newTestLDAPServer(t)
+	url := server.URL()
+	server.listener.Close()
+
+	_, err := NewLDAPAuthenticator(testLDAPConfig(url)).verify("alice", "alice-secret")
+	assert.True(t, errors.Is(err, ErrLDAPUnavailable), "got %v", err)
+}
+
+func TestLDAPMapRoleWithoutMapping(t *testing.T) {
+	cfg := testLDAPConfig("ldap://127.0.0.1")
+	cfg.GroupRoles = nil
+
+	assert.Equal(t, "", NewLDAPAuthenticator(cfg).mapRole([]string{"cn=chat-admins,ou=groups,dc=example,dc=com"}))
+}
+
+func TestNewAuthenticators(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.Backends = []string{"ldap", "local"}
+
+	authenticators, err := NewAuthenticators(cfg)
+	require.NoError(t, err)
+	require.Len(t, authenticators, 2)
+	assert.Equal(t, "ldap", authenticators[0].Name())
+	assert.Equal(t, "local", authenticators[1].Name())
+
+	cfg.Auth.Backends = []string{"kerberos"}
+	_, err = NewAuthenticators(cfg)
+	assert.Error(t, err)
+}
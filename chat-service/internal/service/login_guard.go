@@ -0,0 +1,203 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"chat-service/pkg/cache"
+	"chat-service/pkg/utils"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 登录失败审计记录的原因
+const (
+	LoginFailureInvalidCredentials = "invalid_credentials"
+	LoginFailureInvalidTwoFactor   = "invalid_2fa_code"
+	LoginFailureLocked             = "locked"
+	LoginFailureThrottled          = "throttled"
+)
+
+// LoginBlockedError 登录被暂时拒绝，Locked为true表示账号或IP已被锁定，否则为失败后的退避等待
+type LoginBlockedError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return "登录失败次数过多，账号已被临时锁定"
+	}
+	return "登录尝试过于频繁，请稍后再试"
+}
+
+// LoginGuardService 按用户名和IP统计登录失败次数，失败后按指数退避限制重试，超过阈值后临时锁定
+type LoginGuardService struct{}
+
+func NewLoginGuardService() *LoginGuardService {
+	return &LoginGuardService{}
+}
+
+// Check 校验密码前调用，账号或IP处于锁定或退避期间时返回LoginBlockedError
+func (s *LoginGuardService) Check(username, ip string) error {
+	ctx := context.Background()
+	userKey := loginUserKey(username)
+
+	for _, key := range []string{"login_lock:" + userKey, "login_lock:ip:" + ip} {
+		ttl, err := cache.BlockedFor(ctx, key)
+		if err != nil {
+			return err
+		}
+		if ttl > 0 {
+			return &LoginBlockedError{Locked: true, RetryAfter: ttl}
+		}
+	}
+
+	ttl, err := cache.BlockedFor(ctx, "login_backoff:"+userKey)
+	if err != nil {
+		return err
+	}
+	if ttl > 0 {
+		return &LoginBlockedError{RetryAfter: ttl}
+	}
+	return nil
+}
+
+// RecordFailure 记录一次密码或两步验证码错误，更新计数并按需设置退避或锁定
+func (s *LoginGuardService) RecordFailure(username, ip, userAgent, reason string, cfg *config.AuthConfig) error {
+	ctx := context.Background()
+	userKey := loginUserKey(username)
+	window := time.Duration(cfg.FailureWindowMinute) * time.Minute
+	lockout := time.Duration(cfg.LockoutMinute) * time.Minute
+
+	s.audit(username, ip, userAgent, reason)
+
+	failures, err := cache.IncrWithTTL(ctx, "login_failures:"+userKey, window)
+	if err != nil {
+		return err
+	}
+	ipFailures, err := cache.IncrWithTTL(ctx, "login_failures:ip:"+ip, window)
+	if err != nil {
+		return err
+	}
+
+	if cfg.MaxFailedAttempts > 0 && failures >= int64(cfg.MaxFailedAttempts) {
+		if err := cache.Block(ctx, "login_lock:"+userKey, lockout); err != nil {
+			return err
+		}
+		// 锁定结束后重新计数
+		if err := cache.ResetCounter(ctx, "login_failures:"+userKey); err != nil {
+			return err
+		}
+		s.audit(username, ip, userAgent, LoginFailureLocked)
+		log.Printf("用户名 %s 登录失败%d次，已锁定%v", username, failures, lockout)
+	} else if delay := backoffDelay(failures, cfg); delay > 0 {
+		if err := cache.Block(ctx, "login_backoff:"+userKey, delay); err != nil {
+			return err
+		}
+	}
+
+	if cfg.IPMaxFailedAttempts > 0 && ipFailures >= int64(cfg.IPMaxFailedAttempts) {
+		if err := cache.Block(ctx, "login_lock:ip:"+ip, lockout); err != nil {
+			return err
+		}
+		if err := cache.ResetCounter(ctx, "login_failures:ip:"+ip); err != nil {
+			return err
+		}
+		log.Printf("IP %s 登录失败%d次，已暂停登录%v", ip, ipFailures, lockout)
+	}
+	return nil
+}
+
+// RecordBlocked 记录被锁定或退避拒绝的登录尝试
+func (s *LoginGuardService) RecordBlocked(username, ip, userAgent string, blocked *LoginBlockedError) {
+	reason := LoginFailureThrottled
+	if blocked.Locked {
+		reason = LoginFailureLocked
+	}
+	s.audit(username, ip, userAgent, reason)
+}
+
+// RecordSuccess 完成登录（包括两步验证）后清除该用户名的失败计数。IP计数不清除，
+// 避免攻击者用自己的账号登录来重置计数
+func (s *LoginGuardService) RecordSuccess(username string) error {
+	ctx := context.Background()
+	userKey := loginUserKey(username)
+	if err := cache.ResetCounter(ctx, "login_failures:"+userKey); err != nil {
+		return err
+	}
+	return cache.Unblock(ctx, "login_backoff:"+userKey)
+}
+
+// Unlock 管理员解除用户的登录锁定和失败计数
+func (s *LoginGuardService) Unlock(userID uint) error {
+	var user models.User
+	if err := database.GetDB().Select("id", "username").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	userKey := loginUserKey(user.Username)
+	if err := cache.ResetCounter(ctx, "login_failures:"+userKey); err != nil {
+		return err
+	}
+	return cache.Unblock(ctx, "login_lock:"+userKey, "login_backoff:"+userKey)
+}
+
+// GetFailures 分页获取用户的登录失败审计记录
+func (s *LoginGuardService) GetFailures(userID uint, page, pageSize int) ([]models.LoginAttempt, error) {
+	var user models.User
+	if err := database.GetDB().Select("id", "username").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var attempts []models.LoginAttempt
+	err := database.GetDB().Where("username = ?", user.Username).
+		Order("created_at DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&attempts).Error
+	return attempts, err
+}
+
+func (s *LoginGuardService) audit(username, ip, userAgent, reason string) {
+	if len(username) > 100 {
+		username = username[:100]
+	}
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	attempt := models.LoginAttempt{
+		Username:  username,
+		IP:        ip,
+		UserAgent: userAgent,
+		Reason:    reason,
+	}
+	if err := database.GetDB().Create(&attempt).Error; err != nil {
+		log.Printf("保存登录审计记录失败: %v", err)
+	}
+}
+
+// backoffDelay 第n次失败后需要等待 base*2^(n-1)，不超过上限
+func backoffDelay(failures int64, cfg *config.AuthConfig) time.Duration {
+	if failures <= 0 || cfg.BackoffBaseSecond <= 0 {
+		return 0
+	}
+	delay := time.Duration(cfg.BackoffBaseSecond) * time.Second
+	max := time.Duration(cfg.BackoffMaxSecond) * time.Second
+	for i := int64(1); i < failures; i++ {
+		delay *= 2
+		if max > 0 && delay >= max {
+			return max
+		}
+	}
+	if max > 0 && delay > max {
+		return max
+	}
+	return delay
+}
+
+// loginUserKey 用户名不区分大小写，取哈希避免特殊字符进入Redis key
+func loginUserKey(username string) string {
+	return fmt.Sprintf("user:%s", utils.HashToken(strings.ToLower(strings.TrimSpace(username))))
+}
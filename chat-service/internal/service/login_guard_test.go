@@ -0,0 +1,28 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	cfg := &config.AuthConfig{BackoffBaseSecond: 1, BackoffMaxSecond: 60}
+
+	assert.Equal(t, time.Duration(0), backoffDelay(0, cfg))
+	assert.Equal(t, 1*time.Second, backoffDelay(1, cfg))
+	assert.Equal(t, 2*time.Second, backoffDelay(2, cfg))
+	assert.Equal(t, 16*time.Second, backoffDelay(5, cfg))
+	assert.Equal(t, 60*time.Second, backoffDelay(7, cfg))
+	assert.Equal(t, 60*time.Second, backoffDelay(1000, cfg))
+
+	cfg.BackoffBaseSecond = 0
+	assert.Equal(t, time.Duration(0), backoffDelay(3, cfg))
+}
+
+func TestLoginUserKeyIgnoresCase(t *testing.T) {
+	assert.Equal(t, loginUserKey("Alice"), loginUserKey(" alice "))
+	assert.NotEqual(t, loginUserKey("alice"), loginUserKey("bob"))
+}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUserBanned       = errors.New("你已被禁止加入该房间")
+	ErrMemberNotFound   = errors.New("该用户不是房间成员")
+	ErrInvalidRole      = errors.New("无效的角色")
+	ErrRoleUnchanged    = errors.New("成员已是该角色")
+	ErrBanNotFound      = errors.New("该用户未被封禁")
+	ErrCannotTargetSelf = errors.New("不能对自己执行该操作")
+)
+
+// MemberService 房间成员角色管理、移除、封禁和群主转让，每个操作都会生成一条系统消息
+type MemberService struct{}
+
+func NewMemberService() *MemberService {
+	return &MemberService{}
+}
+
+// GetMember 获取房间成员，不是成员时返回nil
+func (s *MemberService) GetMember(roomID, userID uint) (*models.RoomMember, error) {
+	var member models.RoomMember
+	err := database.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// IsBanned 判断用户是否被禁止加入房间
+func (s *MemberService) IsBanned(roomID, userID uint) (bool, error) {
+	return isBanned(database.GetDB(), roomID, userID)
+}
+
+// GetBans 获取房间的封禁列表
+func (s *MemberService) GetBans(roomID uint) ([]models.RoomBan, error) {
+	var bans []models.RoomBan
+	err := database.GetDB().Preload("User").Where("room_id = ?", roomID).
+		Order("created_at DESC").Find(&bans).Error
+	return bans, err
+}
+
+// ChangeRole 设置或取消管理员
+func (s *MemberService) ChangeRole(roomID, actorID, targetID uint, role string) (*models.Message, error) {
+	if role != models.RoomRoleAdmin && role != models.RoomRoleMember {
+		return nil, ErrInvalidRole
+	}
+
+	var msg *models.Message
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var member models.RoomMember
+		if err := tx.Where("room_id = ? AND user_id = ?", roomID, targetID).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrMemberNotFound
+			}
+			return err
+		}
+		if member.Role == role {
+			return ErrRoleUnchanged
+		}
+		if err := tx.Model(&member).Update("role", role).Error; err != nil {
+			return err
+		}
+
+		format := "%s 将 %s 设为管理员"
+		if role == models.RoomRoleMember {
+			format = "%s 取消了 %s 的管理员身份"
+		}
+		var err error
+		msg, err = createSystemMessage(tx, roomID, actorID, format, actorID, targetID)
+		return err
+	})
+	return msg, err
+}
+
+// RemoveMember 将成员移出房间
+func (s *MemberService) RemoveMember(roomID, actorID, targetID uint) (*models.Message, error) {
+	var msg *models.Message
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("room_id = ? AND user_id = ?", roomID, targetID).Delete(&models.RoomMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrMemberNotFound
+		}
+
+		var err error
+		msg, err = createSystemMessage(tx, roomID, actorID, "%s 将 %s 移出了群聊", actorID, targetID)
+		return err
+	})
+	return msg, err
+}
+
+// BanMember 封禁用户并将其移出房间，被封禁的用户不能再通过任何方式加入
+func (s *MemberService) BanMember(roomID, actorID, targetID uint, reason string) (*models.Message, error) {
+	var msg *models.Message
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 并发封禁同一用户时唯一索引冲突，保留先封禁的记录
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RoomBan{
+			RoomID:   roomID,
+			UserID:   targetID,
+			BannedBy: actorID,
+			Reason:   reason,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("room_id = ? AND user_id = ?", roomID, targetID).
+			Delete(&models.RoomMember{}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		msg, err = createSystemMessage(tx, roomID, actorID, "%s 封禁了 %s", actorID, targetID)
+		return err
+	})
+	return msg, err
+}
+
+// UnbanMember 解除封禁，用户需要重新被邀请才能加入
+func (s *MemberService) UnbanMember(roomID, targetID uint) error {
+	result := database.GetDB().Where("room_id = ? AND user_id = ?", roomID, targetID).Delete(&models.RoomBan{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBanNotFound
+	}
+	return nil
+}
+
+// TransferOwnership 将群主身份转让给其他成员，原群主成为管理员
+func (s *MemberService) TransferOwnership(roomID, ownerID, targetID uint) (*models.Message, error) {
+	if ownerID == targetID {
+		return nil, ErrCannotTargetSelf
+	}
+
+	var msg *models.Message
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var target models.RoomMember
+		if err := tx.Where("room_id = ? AND user_id = ?", roomID, targetID).First(&target).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrMemberNotFound
+			}
+			return err
+		}
+
+		// 条件更新保证并发转让时只有一次成功
+		result := tx.Model(&models.ChatRoom{}).Where("id = ? AND owner_id = ?", roomID, ownerID).
+			Update("owner_id", targetID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPermissionDenied
+		}
+
+		if err := tx.Model(&models.RoomMember{}).Where("room_id = ? AND user_id = ?", roomID, ownerID).
+			Update("role", models.RoomRoleAdmin).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&target).Update("role", models.RoomRoleOwner).Error; err != nil {
+			return err
+		}
+
+		var err error
+		msg, err = createSystemMessage(tx, roomID, ownerID, "%s 将群主转让给了 %s", ownerID, targetID)
+		return err
+	})
+	return msg, err
+}
+
+func isBanned(tx *gorm.DB, roomID, userID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.RoomBan{}).Where("room_id = ? AND user_id = ?", roomID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// createSystemMessage 保存一条系统消息，format中的%s依次替换为userIDs对应的昵称
+func createSystemMessage(tx *gorm.DB, roomID, senderID uint, format string, userIDs ...uint) (*models.Message, error) {
+	args := make([]interface{}, 0, len(userIDs))
+	for _, id := range userIDs {
+		var user models.User
+		name := fmt.Sprintf("用户%d", id)
+		if err := tx.Unscoped().Select("id", "nickname", "username").First(&user, id).Error; err == nil {
+			name = user.Nickname
+			if name == "" {
+				name = user.Username
+			}
+		}
+		args = append(args, name)
+	}
+
+	msg := &models.Message{
+		RoomID:   roomID,
+		SenderID: senderID,
+		Content:  fmt.Sprintf(format, args...),
+		Type:     "system",
+	}
+	if err := tx.Create(msg).Error; err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"chat-service/pkg/cache"
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// mentionPattern @前面不能是邮箱地址中可能出现的字符，避免把邮箱当成@；中文后面直接@是允许的
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.+\-@])@([\p{L}\p{N}_.\-]+)`)
+
+// GetMentions 获取消息中@到的用户
+func (s *MessageService) GetMentions(messageID uint) ([]models.MessageMention, error) {
+	var mentions []models.MessageMention
+	err := database.GetDB().Where("message_id = ?", messageID).Find(&mentions).Error
+	return mentions, err
+}
+
+// GetMentionCount 统计用户在房间中最后阅读之后被@的次数，不包括用户仅为自己删除的消息
+func (s *MessageService) GetMentionCount(userID, roomID uint) (int64, error) {
+	var member models.RoomMember
+	err := database.GetDB().Select("last_read").
+		Where("user_id = ? AND room_id = ?", userID, roomID).
+		First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrNotRoomMember
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err = database.GetDB().Model(&models.MessageMention{}).
+		Joins("JOIN messages ON messages.id = message_mentions.message_id").
+		Where("message_mentions.user_id = ? AND message_mentions.room_id = ? AND messages.is_deleted = false AND message_mentions.created_at > ?",
+			userID, roomID, member.LastRead).
+		Where("NOT EXISTS (SELECT 1 FROM hidden_messages WHERE hidden_messages.message_id = messages.id AND hidden_messages.user_id = ?)", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// createMentions 解析文本消息中的@并保存，只记录房间成员，不包括发送者自己，返回新增的记录。
+// 编辑消息时也会调用，已经记录过的用户不会重复记录
+func createMentions(tx *gorm.DB, msg *models.Message) ([]models.MessageMention, error) {
+	if msg.Type != "text" {
+		return nil, nil
+	}
+	usernames, here, all := parseMentions(msg.Content)
+	if len(usernames) == 0 && !here && !all {
+		return nil, nil
+	}
+
+	kinds := make(map[uint]string)
+	if here || all {
+		var memberIDs []uint
+		if err := tx.Model(&models.RoomMember{}).Where("room_id = ?", msg.RoomID).
+			Pluck("user_id", &memberIDs).Error; err != nil {
+			return nil, err
+		}
+
+		online := make(map[uint]bool)
+		if !all {
+			// 在线状态获取失败时@here不通知任何人，不影响消息发送
+			userIDs, err := cache.GetRoomUsers(context.Background(), msg.RoomID)
+			if err != nil {
+				log.Printf("获取房间在线用户失败: %v", err)
+			}
+			for _, id := range userIDs {
+				online[id] = true
+			}
+		}
+
+		for _, id := range memberIDs {
+			if all {
+				kinds[id] = models.MentionAll
+			} else if online[id] {
+				kinds[id] = models.MentionHere
+			}
+		}
+	}
+
+	if len(usernames) > 0 {
+		var userIDs []uint
+		err := tx.Table("room_members").
+			Joins("JOIN users ON users.id = room_members.user_id").
+			Where("room_members.room_id = ? AND room_members.deleted_at IS NULL AND users.username IN ?", msg.RoomID, usernames).
+			Pluck("room_members.user_id", &userIDs).Error
+		if err != nil {
+			return nil, err
+		}
+		// 同时被直接@和@all时按直接@记录
+		for _, id := range userIDs {
+			kinds[id] = models.MentionUser
+		}
+	}
+	delete(kinds, msg.SenderID)
+
+	// 编辑时新增的@按编辑时间计入未读，之前已经@过的用户不再记录和通知
+	createdAt := msg.CreatedAt
+	if msg.EditedAt != nil {
+		createdAt = *msg.EditedAt
+
+		var mentioned []uint
+		if err := tx.Model(&models.MessageMention{}).Where("message_id = ?", msg.ID).
+			Pluck("user_id", &mentioned).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range mentioned {
+			delete(kinds, id)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	mentions := make([]models.MessageMention, 0, len(kinds))
+	for userID, kind := range kinds {
+		mentions = append(mentions, models.MessageMention{
+			MessageID: msg.ID,
+			RoomID:    msg.RoomID,
+			UserID:    userID,
+			Kind:      kind,
+			CreatedAt: createdAt,
+		})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&mentions).Error; err != nil {
+		return nil, err
+	}
+	return mentions, nil
+}
+
+// parseMentions 从消息内容中解析@username、@here和@all，用户名去重
+func parseMentions(content string) (usernames []string, here, all bool) {
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// 句末的标点不是用户名的一部分
+		name := strings.TrimRight(match[1], ".-")
+		switch {
+		case name == "":
+		case name == models.MentionHere:
+			here = true
+		case name == models.MentionAll:
+			all = true
+		case !seen[name]:
+			seen[name] = true
+			usernames = append(usernames, name)
+		}
+	}
+	return usernames, here, all
+}
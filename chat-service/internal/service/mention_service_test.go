@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	usernames, here, all := parseMentions("@alice 看一下，@bob.smith 和 @alice 也是。")
+	assert.Equal(t, []string{"alice", "bob.smith"}, usernames)
+	assert.False(t, here)
+	assert.False(t, all)
+
+	usernames, here, all = parseMentions("@here 开会了，@all")
+	assert.Empty(t, usernames)
+	assert.True(t, here)
+	assert.True(t, all)
+
+	// 邮箱地址和句末标点
+	usernames, _, _ = parseMentions("发到 alice@example.com，或者问@张三.")
+	assert.Equal(t, []string{"张三"}, usernames)
+
+	usernames, here, all = parseMentions("没有提到任何人 @ ")
+	assert.Empty(t, usernames)
+	assert.False(t, here)
+	assert.False(t, all)
+}
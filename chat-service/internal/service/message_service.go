@@ -0,0 +1,233 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMessageNotFound     = errors.New("消息不存在")
+	ErrReplyTargetNotFound = errors.New("回复的消息不存在")
+	ErrNotMessageSender    = errors.New("只能编辑自己发送的消息")
+	ErrMessageNotEditable  = errors.New("该消息不能编辑")
+	ErrEditWindowExpired   = errors.New("已超过可编辑的时间")
+	ErrMessageTooLong      = errors.New("消息内容不能超过1000个字")
+)
+
+// maxMessageRunes 消息内容的最大字数，REST和WebSocket共用
+const maxMessageRunes = 1000
+
+// SendMessage 保存消息并记录其中的@。回复消息时同一话题只有一层，回复话题中的回复会归到话题的第一条消息下，
+// 并更新其回复数和最后回复时间。返回值为话题的第一条消息，不是回复时为nil
+func (s *MessageService) SendMessage(msg *models.Message) (*models.Message, error) {
+	var root *models.Message
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if msg.ReplyToID != nil {
+			var err error
+			root, err = lockThreadRoot(tx, msg.RoomID, *msg.ReplyToID)
+			if err != nil {
+				return err
+			}
+			msg.ReplyToID = &root.ID
+		}
+
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		if _, err := createMentions(tx, msg); err != nil {
+			return err
+		}
+		if root == nil {
+			return nil
+		}
+
+		root.ReplyCount++
+		root.LastReplyAt = &msg.CreatedAt
+		return tx.Model(&models.Message{}).Where("id = ?", root.ID).Updates(map[string]interface{}{
+			"reply_count":   gorm.Expr("reply_count + 1"),
+			"last_reply_at": msg.CreatedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	indexMessage(msg)
+	return root, nil
+}
+
+// GetThreadReplies 按时间正序分页获取话题中的回复
+func (s *MessageService) GetThreadReplies(rootID uint, page, pageSize int) ([]models.Message, error) {
+	var replies []models.Message
+	err := database.GetDB().
+		Preload("Sender").
+		Where("reply_to_id = ? AND is_deleted = false", rootID).
+		Order("created_at ASC, id ASC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&replies).Error
+	return replies, err
+}
+
+// GetThreadRoot 获取消息所在话题的第一条消息，消息本身不是回复时返回它自己
+func (s *MessageService) GetThreadRoot(messageID uint) (*models.Message, error) {
+	message, err := loadMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	// 回复保存时已经指向第一条消息，不需要继续向上查找
+	if message.ReplyToID != nil {
+		if message, err = loadMessage(*message.ReplyToID); err != nil {
+			return nil, err
+		}
+	}
+	scrubDeleted(message)
+	return message, nil
+}
+
+func loadMessage(messageID uint) (*models.Message, error) {
+	var message models.Message
+	if err := database.GetDB().Preload("Sender").First(&message, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetThreadParticipants 获取话题的参与者，即第一条消息的发送者和所有回复者，已离开房间的用户除外
+func (s *MessageService) GetThreadParticipants(root *models.Message) ([]uint, error) {
+	var userIDs []uint
+	err := database.GetDB().Model(&models.RoomMember{}).
+		Where("room_id = ?", root.RoomID).
+		Where("user_id = ? OR user_id IN (?)", root.SenderID,
+			database.GetDB().Model(&models.Message{}).Select("sender_id").
+				Where("reply_to_id = ? AND is_deleted = false", root.ID)).
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// EditMessage 修改消息内容，修改前的内容保存到编辑历史，并记录新增的@。window为发送后可编辑的时长，0表示不限制。
+// 返回编辑后的消息和本次编辑新增的@记录
+func (s *MessageService) EditMessage(messageID, userID uint, content string, window time.Duration) (*models.Message, []models.MessageMention, error) {
+	if utf8.RuneCountInString(content) > maxMessageRunes {
+		return nil, nil, ErrMessageTooLong
+	}
+
+	var message models.Message
+	var mentions []models.MessageMention
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND is_deleted = false", messageID).
+			First(&message).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkEditable(&message, userID, window, time.Now()); err != nil {
+			return err
+		}
+
+		// 已离开房间或房间归档后不能再编辑
+		access, err := GetRoomAccess(userID, message.RoomID)
+		if err != nil {
+			return err
+		}
+		if !access.CanPostMessage() {
+			if access.IsArchived() {
+				return ErrRoomArchived
+			}
+			return ErrPermissionDenied
+		}
+
+		now := time.Now()
+		edit := &models.MessageEdit{
+			MessageID: message.ID,
+			Content:   message.Content,
+			CreatedAt: now,
+		}
+		if err := tx.Create(edit).Error; err != nil {
+			return err
+		}
+
+		message.Content = content
+		message.EditedAt = &now
+		if err := tx.Model(&message).Updates(map[string]interface{}{
+			"content":   content,
+			"edited_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		mentions, err = createMentions(tx, &message)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	indexMessage(&message)
+	return &message, mentions, nil
+}
+
+// GetEditHistory 获取消息的编辑历史，按时间正序
+func (s *MessageService) GetEditHistory(messageID uint) ([]models.MessageEdit, error) {
+	var edits []models.MessageEdit
+	err := database.GetDB().
+		Where("message_id = ?", messageID).
+		Order("created_at ASC, id ASC").
+		Find(&edits).Error
+	return edits, err
+}
+
+// checkEditable 只有发送者可以在发送后的window内编辑自己的文本消息
+func checkEditable(message *models.Message, userID uint, window time.Duration, now time.Time) error {
+	if message.SenderID != userID {
+		return ErrNotMessageSender
+	}
+	if message.Type != "text" {
+		return ErrMessageNotEditable
+	}
+	if window > 0 && now.Sub(message.CreatedAt) > window {
+		return ErrEditWindowExpired
+	}
+	return nil
+}
+
+// scrubDeleted 清除已删除消息的内容，兼容删除时没有清空内容的旧数据
+func scrubDeleted(message *models.Message) {
+	if message.IsDeleted {
+		message.Content = ""
+		message.EditedAt = nil
+	}
+}
+
+// lockThreadRoot 锁定被回复消息所在话题的第一条消息，被回复的消息必须在同一房间且未被删除
+func lockThreadRoot(tx *gorm.DB, roomID, messageID uint) (*models.Message, error) {
+	target, err := lockReplyTarget(tx, roomID, messageID)
+	if err != nil || target.ReplyToID == nil {
+		return target, err
+	}
+	// 回复保存时已经指向第一条消息，不需要继续向上查找
+	return lockReplyTarget(tx, roomID, *target.ReplyToID)
+}
+
+func lockReplyTarget(tx *gorm.DB, roomID, messageID uint) (*models.Message, error) {
+	var target models.Message
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND room_id = ? AND is_deleted = false", messageID, roomID).
+		First(&target).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReplyTargetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
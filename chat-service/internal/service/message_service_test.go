@@ -0,0 +1,43 @@
+package service
+
+import (
+	"chat-service/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckEditable(t *testing.T) {
+	now := time.Now()
+	message := &models.Message{SenderID: 1, Type: "text", CreatedAt: now.Add(-10 * time.Minute)}
+
+	assert.NoError(t, checkEditable(message, 1, 15*time.Minute, now))
+	assert.ErrorIs(t, checkEditable(message, 2, 15*time.Minute, now), ErrNotMessageSender)
+	assert.ErrorIs(t, checkEditable(message, 1, 5*time.Minute, now), ErrEditWindowExpired)
+
+	// 0表示不限制编辑时间
+	assert.NoError(t, checkEditable(message, 1, 0, now))
+
+	system := &models.Message{SenderID: 1, Type: "system", CreatedAt: now}
+	assert.ErrorIs(t, checkEditable(system, 1, 0, now), ErrMessageNotEditable)
+}
+
+func TestEditMessageTooLong(t *testing.T) {
+	// 超长内容在访问数据库之前被拒绝，WebSocket编辑和REST接口共用该限制
+	_, _, err := NewMessageService().EditMessage(1, 1, strings.Repeat("字", maxMessageRunes+1), 0)
+	assert.ErrorIs(t, err, ErrMessageTooLong)
+}
+
+func TestScrubDeleted(t *testing.T) {
+	now := time.Now()
+	message := &models.Message{Content: "hello", EditedAt: &now}
+	scrubDeleted(message)
+	assert.Equal(t, "hello", message.Content)
+
+	message.IsDeleted = true
+	scrubDeleted(message)
+	assert.Empty(t, message.Content)
+	assert.Nil(t, message.EditedAt)
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"chat-service/pkg/oidc"
+	"chat-service/pkg/utils"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSSOEmailMissing    = errors.New("身份提供方未返回邮箱")
+	ErrSSOAccountNotFound = errors.New("没有与该SSO账号关联的用户")
+	ErrSSOEmailConflict   = errors.New("该邮箱已被其他账号使用且未经身份提供方验证")
+)
+
+var usernameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+type OIDCService struct{}
+
+func NewOIDCService() *OIDCService {
+	return &OIDCService{}
+}
+
+// ResolveUser 将IdP账号映射为本地用户：优先按已关联的subject查找，其次按已验证的邮箱关联
+// 现有账号，最后在允许时自动创建新用户。reclaimed为true表示关联的是邮箱未验证的账号，
+// 其原有的密码、两步验证、个人访问token和外部身份已被清除，调用方还需要吊销它的会话
+func (s *OIDCService) ResolveUser(provider string, claims *oidc.IDTokenClaims, cfg *config.OIDCConfig) (user *models.User, reclaimed bool, err error) {
+	user = &models.User{}
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+		if err == nil {
+			return tx.First(user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if claims.Email == "" {
+			return ErrSSOEmailMissing
+		}
+
+		err = tx.Where("email = ?", claims.Email).First(user).Error
+		switch {
+		case err == nil:
+			switch ssoLinkAction(user, claims) {
+			case ssoConflict:
+				return ErrSSOEmailConflict
+			case ssoReclaim:
+				if err := reclaimAccount(tx, user); err != nil {
+					return err
+				}
+				reclaimed = true
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !cfg.AutoProvision {
+				return ErrSSOAccountNotFound
+			}
+			if err := s.provisionUser(tx, user, claims); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return user, reclaimed, nil
+}
+
+// 按邮箱找到已有账号时的处理方式
+const (
+	ssoLink     = iota // 直接关联
+	ssoReclaim         // 本地账号的邮箱未经验证，可能是他人抢注的，清除其凭据后再关联
+	ssoConflict        // IdP没有验证邮箱，拒绝关联
+)
+
+// ssoLinkAction 只有IdP确认过的邮箱才能关联到已有账号，防止冒用他人邮箱
+func ssoLinkAction(user *models.User, claims *oidc.IDTokenClaims) int {
+	switch {
+	case !claims.EmailVerified:
+		return ssoConflict
+	case user.Status == models.UserStatusPendingVerification:
+		return ssoReclaim
+	default:
+		return ssoLink
+	}
+}
+
+// reclaimAccount 邮箱所有者通过IdP证明了身份，收回邮箱未验证的账号：清除抢注者设置的密码和两步验证，
+// 吊销个人访问token并解除其他外部身份的关联，然后标记为已验证
+func reclaimAccount(tx *gorm.DB, user *models.User) error {
+	user.Password = ""
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.Status = models.UserStatusActive
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":     "",
+		"totp_secret":  "",
+		"totp_enabled": false,
+		"status":       models.UserStatusActive,
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserIdentity{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *OIDCService) provisionUser(tx *gorm.DB, user *models.User, claims *oidc.IDTokenClaims) error {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	username, err := uniqueUsername(tx, base)
+	if err != nil {
+		return err
+	}
+
+	nickname := claims.Name
+	if nickname == "" {
+		nickname = username
+	}
+
+	status := models.UserStatusActive
+	if !claims.EmailVerified {
+		status = models.UserStatusPendingVerification
+	}
+
+	// SSO用户没有本地密码，如需密码登录可以走重置密码流程
+	*user = models.User{
+		Username: username,
+		Nickname: nickname,
+		Avatar:   claims.Picture,
+		Email:    claims.Email,
+		Status:   status,
+	}
+	return tx.Create(user).Error
+}
+
+// uniqueUsername 以外部账号的用户名为基础生成不重复的本地用户名
+func uniqueUsername(tx *gorm.DB, base string) (string, error) {
+	base = usernameSanitizer.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = "user" + base
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Unscoped().Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = base + "_" + utils.GenerateRandomString(6)
+	}
+	return "", errors.New("无法生成唯一的用户名")
+}
@@ -0,0 +1,23 @@
+package service
+
+import (
+	"chat-service/internal/models"
+	"chat-service/pkg/oidc"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSOLinkAction(t *testing.T) {
+	verified := &oidc.IDTokenClaims{Email: "alice@example.com", EmailVerified: true}
+	unverified := &oidc.IDTokenClaims{Email: "alice@example.com"}
+
+	active := &models.User{Email: "alice@example.com", Status: models.UserStatusActive}
+	assert.Equal(t, ssoLink, ssoLinkAction(active, verified))
+	assert.Equal(t, ssoConflict, ssoLinkAction(active, unverified))
+
+	// 他人用受害者邮箱注册后未验证，受害者首次SSO登录时收回该账号，抢注者的密码不再有效
+	squatted := &models.User{Email: "alice@example.com", Status: models.UserStatusPendingVerification}
+	assert.Equal(t, ssoReclaim, ssoLinkAction(squatted, verified))
+	assert.Equal(t, ssoConflict, ssoLinkAction(squatted, unverified))
+}
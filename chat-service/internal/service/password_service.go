@@ -0,0 +1,203 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"chat-service/pkg/mail"
+	"chat-service/pkg/utils"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWrongPassword     = errors.New("原密码错误")
+	ErrResetTokenInvalid = errors.New("重置链接无效或已过期")
+	ErrPasswordTooLong   = errors.New("密码不能超过72个字节")
+	ErrPasswordUnchanged = errors.New("新密码不能与原密码相同")
+)
+
+// PasswordPolicyError 密码不满足强度要求
+type PasswordPolicyError struct {
+	Reasons []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "密码不符合要求: " + strings.Join(e.Reasons, "，")
+}
+
+// ValidatePassword 按配置的密码策略检查密码强度
+func ValidatePassword(password string, policy *config.PasswordConfig) error {
+	// bcrypt只使用前72个字节
+	if len(password) > 72 {
+		return ErrPasswordTooLong
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	var reasons []string
+	if len([]rune(password)) < policy.MinLength {
+		reasons = append(reasons, fmt.Sprintf("长度至少为%d位", policy.MinLength))
+	}
+	if policy.RequireUpper && !hasUpper {
+		reasons = append(reasons, "需要包含大写字母")
+	}
+	if policy.RequireLower && !hasLower {
+		reasons = append(reasons, "需要包含小写字母")
+	}
+	if policy.RequireDigit && !hasDigit {
+		reasons = append(reasons, "需要包含数字")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		reasons = append(reasons, "需要包含特殊字符")
+	}
+
+	if len(reasons) > 0 {
+		return &PasswordPolicyError{Reasons: reasons}
+	}
+	return nil
+}
+
+type PasswordService struct {
+	authService *AuthService
+}
+
+func NewPasswordService() *PasswordService {
+	return &PasswordService{
+		authService: NewAuthService(),
+	}
+}
+
+// ChangePassword 修改密码，成功后吊销除当前会话以外的所有会话并返回其ID
+func (s *PasswordService) ChangePassword(userID, currentSessionID uint, oldPassword, newPassword string, cfg *config.Config) ([]uint, error) {
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+		return nil, ErrWrongPassword
+	}
+	if oldPassword == newPassword {
+		return nil, ErrPasswordUnchanged
+	}
+	if err := ValidatePassword(newPassword, &cfg.Password); err != nil {
+		return nil, err
+	}
+
+	if err := s.setPassword(database.GetDB(), userID, newPassword); err != nil {
+		return nil, err
+	}
+
+	return s.authService.RevokeOtherSessions(userID, currentSessionID, &cfg.JWT)
+}
+
+// RequestPasswordReset 为邮箱对应的用户生成重置token并发送邮件。
+// 邮箱不存在时同样返回nil，避免泄露账号是否存在
+func (s *PasswordService) RequestPasswordReset(email string, cfg *config.Config) error {
+	var user models.User
+	err := database.GetDB().Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token := utils.GenerateRandomString(64)
+	reset := &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(time.Duration(cfg.Password.ResetExpireMinute) * time.Minute),
+	}
+	if err := database.GetDB().Create(reset).Error; err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", strings.TrimRight(cfg.Server.PublicURL, "/"), token)
+	body := fmt.Sprintf("%s，您好：\n\n请在%d分钟内打开以下链接重置密码：\n%s\n\n如果这不是您本人的操作，请忽略此邮件。",
+		user.Nickname, cfg.Password.ResetExpireMinute, link)
+
+	// 异步发送，避免根据响应时间判断邮箱是否存在
+	go func() {
+		if err := mail.Send(user.Email, "重置密码", body); err != nil {
+			log.Printf("重置密码邮件发送失败: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ResetPassword 使用重置token设置新密码，并吊销该用户的所有会话，返回被吊销的会话ID
+func (s *PasswordService) ResetPassword(token, newPassword string, cfg *config.Config) ([]uint, error) {
+	if err := ValidatePassword(newPassword, &cfg.Password); err != nil {
+		return nil, err
+	}
+
+	var userID uint
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		if err := tx.Where("token_hash = ?", utils.HashToken(token)).First(&reset).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrResetTokenInvalid
+			}
+			return err
+		}
+		if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+			return ErrResetTokenInvalid
+		}
+
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetTokenInvalid
+		}
+
+		// 密码已重置，该用户其他未使用的重置链接一并作废
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", reset.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		userID = reset.UserID
+		return s.setPassword(tx, reset.UserID, newPassword)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authService.RevokeOtherSessions(userID, 0, &cfg.JWT)
+}
+
+func (s *PasswordService) setPassword(tx *gorm.DB, userID uint, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("password", string(hashed)).Error
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePassword(t *testing.T) {
+	policy := &config.PasswordConfig{
+		MinLength:     8,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+
+	assert.NoError(t, ValidatePassword("secret-123", policy))
+
+	// 长度不足且缺少数字和特殊字符
+	err := ValidatePassword("abc", policy)
+	var policyErr *PasswordPolicyError
+	assert.True(t, errors.As(err, &policyErr))
+	assert.Len(t, policyErr.Reasons, 3)
+
+	// 超过bcrypt的长度限制
+	err = ValidatePassword(strings.Repeat("a1-", 30), policy)
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoomNotFound     = errors.New("房间不存在")
+	ErrNotRoomMember    = errors.New("你不是该房间的成员")
+	ErrPermissionDenied = errors.New("没有权限执行该操作")
+)
+
+// roleRank 角色等级，等级高的成员可以管理等级低的成员
+var roleRank = map[string]int{
+	models.RoomRoleMember: 1,
+	models.RoomRoleAdmin:  2,
+	models.RoomRoleOwner:  3,
+}
+
+// RoomAccess 用户在某个房间中的权限，由成员角色和房间设置共同决定。
+// Member为nil表示用户不是该房间的成员
+type RoomAccess struct {
+	Room   *models.ChatRoom
+	Member *models.RoomMember
+}
+
+// GetRoomAccess 加载房间和用户的成员记录，房间不存在时返回ErrRoomNotFound
+func GetRoomAccess(userID, roomID uint) (*RoomAccess, error) {
+	var room models.ChatRoom
+	if err := database.GetDB().First(&room, roomID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoomNotFound
+		}
+		return nil, err
+	}
+
+	access := &RoomAccess{Room: &room}
+	var member models.RoomMember
+	err := database.GetDB().Where("room_id = ? AND user_id = ?", roomID, userID).First(&member).Error
+	switch {
+	case err == nil:
+		access.Member = &member
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+	return access, nil
+}
+
+// Role 返回用户在房间中的角色，非成员为空
+func (a *RoomAccess) Role() string {
+	if a.Member == nil {
+		return ""
+	}
+	return a.Member.Role
+}
+
+func (a *RoomAccess) IsMember() bool {
+	return a.Member != nil
+}
+
+// IsAdmin 群主或管理员
+func (a *RoomAccess) IsAdmin() bool {
+	return roleRank[a.Role()] >= roleRank[models.RoomRoleAdmin]
+}
+
+// IsArchived 归档的房间只读，仍然可以查看和搜索历史消息
+func (a *RoomAccess) IsArchived() bool {
+	return a.Room.ArchivedAt != nil
+}
+
+// CanView 查看房间信息、成员和消息
+func (a *RoomAccess) CanView() bool {
+	return a.IsMember()
+}
+
+// CanJoin 主动加入房间，只有公开的群聊可以直接加入，已是成员时视为允许
+func (a *RoomAccess) CanJoin() bool {
+	if a.IsMember() {
+		return true
+	}
+	return a.Room.Type == "group" && a.Room.Visibility == models.RoomVisibilityPublic && !a.IsArchived()
+}
+
+// CanRequestJoin 申请加入需要审核的群聊
+func (a *RoomAccess) CanRequestJoin() bool {
+	if a.IsMember() || a.IsArchived() {
+		return false
+	}
+	return a.Room.Type == "group" && a.Room.Visibility == models.RoomVisibilityRequestToJoin
+}
+
+// CanReviewJoinRequests 审核加入申请，只有群主和管理员可以操作
+func (a *RoomAccess) CanReviewJoinRequests() bool {
+	return a.IsAdmin() && a.Room.Type == "group"
+}
+
+// CanLeave 群主需要先转让群主身份才能离开群聊
+func (a *RoomAccess) CanLeave() bool {
+	if !a.IsMember() {
+		return false
+	}
+	return a.Room.Type != "group" || a.Role() != models.RoomRoleOwner
+}
+
+// CanPostMessage 发送消息，开启仅管理员发言时普通成员不能发送
+func (a *RoomAccess) CanPostMessage() bool {
+	if !a.IsMember() || a.IsArchived() {
+		return false
+	}
+	return !a.Room.OnlyAdminsPost || a.IsAdmin()
+}
+
+// CanReact 对消息做表情回应，仅管理员发言的房间中普通成员也可以回应
+func (a *RoomAccess) CanReact() bool {
+	return a.IsMember() && !a.IsArchived()
+}
+
+// CanDeleteMessage 为所有人删除消息，发送者可以删除自己的消息，群主和管理员可以删除群聊中的任何消息
+func (a *RoomAccess) CanDeleteMessage(message *models.Message) bool {
+	if !a.IsMember() || a.IsArchived() || message.RoomID != a.Room.ID {
+		return false
+	}
+	if message.SenderID == a.Member.UserID {
+		return true
+	}
+	return a.IsAdmin() && a.Room.Type == "group"
+}
+
+// CanInvite 邀请其他用户加入群聊
+func (a *RoomAccess) CanInvite() bool {
+	if !a.IsMember() || a.Room.Type != "group" || a.IsArchived() {
+		return false
+	}
+	return !a.Room.OnlyAdminsInvite || a.IsAdmin()
+}
+
+// CanManageInvites 创建、查看和吊销邀请码，只有群主和管理员可以操作
+func (a *RoomAccess) CanManageInvites() bool {
+	return a.IsAdmin() && a.Room.Type == "group" && !a.IsArchived()
+}
+
+// CanKick 将成员移出群聊，只能移除角色等级低于自己的成员
+func (a *RoomAccess) CanKick(target *models.RoomMember) bool {
+	if !a.IsAdmin() || a.Room.Type != "group" || target == nil {
+		return false
+	}
+	return roleRank[a.Role()] > roleRank[target.Role]
+}
+
+// CanEditRoom 修改房间名称、描述和设置，以及归档和取消归档
+func (a *RoomAccess) CanEditRoom() bool {
+	return a.IsAdmin() && a.Room.Type == "group"
+}
+
+// CanDeleteRoom 删除群聊，只有群主可以操作
+func (a *RoomAccess) CanDeleteRoom() bool {
+	return a.Role() == models.RoomRoleOwner && a.Room.Type == "group"
+}
+
+// CanChangeRole 设置或取消管理员，只有群主可以操作
+func (a *RoomAccess) CanChangeRole(target *models.RoomMember) bool {
+	if a.Role() != models.RoomRoleOwner || a.Room.Type != "group" || target == nil {
+		return false
+	}
+	return target.Role != models.RoomRoleOwner
+}
+
+// CanBan 封禁用户，被封禁的用户不能再加入房间。target为nil表示被封禁的用户不是成员
+func (a *RoomAccess) CanBan(target *models.RoomMember) bool {
+	if target == nil {
+		return a.IsAdmin() && a.Room.Type == "group"
+	}
+	return a.CanKick(target)
+}
+
+// CanTransferOwnership 转让群主身份
+func (a *RoomAccess) CanTransferOwnership() bool {
+	return a.Role() == models.RoomRoleOwner && a.Room.Type == "group"
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"chat-service/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newAccess(room models.ChatRoom, role string) *RoomAccess {
+	access := &RoomAccess{Room: &room}
+	if role != "" {
+		access.Member = &models.RoomMember{Role: role}
+	}
+	return access
+}
+
+func TestRoomAccessMembership(t *testing.T) {
+	group := models.ChatRoom{Type: "group"}
+
+	outsider := newAccess(group, "")
+	assert.False(t, outsider.CanView())
+	assert.False(t, outsider.CanJoin())
+	assert.False(t, newAccess(models.ChatRoom{Type: "single"}, "").CanJoin())
+	assert.False(t, outsider.CanPostMessage())
+	assert.False(t, outsider.CanInvite())
+	assert.False(t, outsider.CanLeave())
+
+	member := newAccess(group, models.RoomRoleMember)
+	assert.True(t, member.CanView())
+	assert.True(t, member.CanPostMessage())
+	assert.True(t, member.CanReact())
+	assert.True(t, member.CanInvite())
+	assert.True(t, member.CanLeave())
+	assert.False(t, member.CanEditRoom())
+	assert.False(t, member.CanManageInvites())
+
+	// 群主不能直接离开群聊，单聊没有群主限制
+	assert.False(t, newAccess(group, models.RoomRoleOwner).CanLeave())
+	assert.True(t, newAccess(models.ChatRoom{Type: "single"}, models.RoomRoleOwner).CanLeave())
+}
+
+func TestRoomAccessSettings(t *testing.T) {
+	room := models.ChatRoom{Type: "group", OnlyAdminsPost: true, OnlyAdminsInvite: true}
+
+	member := newAccess(room, models.RoomRoleMember)
+	assert.False(t, member.CanPostMessage())
+	assert.True(t, member.CanReact())
+	assert.False(t, member.CanInvite())
+
+	admin := newAccess(room, models.RoomRoleAdmin)
+	assert.True(t, admin.CanPostMessage())
+	assert.True(t, admin.CanInvite())
+	assert.True(t, admin.CanEditRoom())
+
+	// 单聊不能邀请、踢人或修改
+	single := newAccess(models.ChatRoom{Type: "single"}, models.RoomRoleOwner)
+	assert.False(t, single.CanInvite())
+	assert.False(t, single.CanEditRoom())
+	assert.False(t, single.CanKick(&models.RoomMember{Role: models.RoomRoleMember}))
+}
+
+func TestRoomAccessCanKick(t *testing.T) {
+	group := models.ChatRoom{Type: "group"}
+	member := &models.RoomMember{Role: models.RoomRoleMember}
+	admin := &models.RoomMember{Role: models.RoomRoleAdmin}
+	owner := &models.RoomMember{Role: models.RoomRoleOwner}
+
+	assert.False(t, newAccess(group, models.RoomRoleMember).CanKick(member))
+	assert.True(t, newAccess(group, models.RoomRoleAdmin).CanKick(member))
+	assert.False(t, newAccess(group, models.RoomRoleAdmin).CanKick(admin))
+	assert.True(t, newAccess(group, models.RoomRoleOwner).CanKick(admin))
+	assert.False(t, newAccess(group, models.RoomRoleOwner).CanKick(owner))
+}
+
+func TestRoomAccessMemberManagement(t *testing.T) {
+	group := models.ChatRoom{Type: "group"}
+	member := &models.RoomMember{Role: models.RoomRoleMember}
+	admin := &models.RoomMember{Role: models.RoomRoleAdmin}
+
+	// 只有群主可以设置管理员和转让群聊
+	assert.True(t, newAccess(group, models.RoomRoleOwner).CanChangeRole(admin))
+	assert.False(t, newAccess(group, models.RoomRoleAdmin).CanChangeRole(member))
+	assert.True(t, newAccess(group, models.RoomRoleOwner).CanTransferOwnership())
+	assert.False(t, newAccess(group, models.RoomRoleAdmin).CanTransferOwnership())
+
+	// 管理员可以封禁普通成员和非成员，不能封禁其他管理员
+	assert.True(t, newAccess(group, models.RoomRoleAdmin).CanBan(member))
+	assert.True(t, newAccess(group, models.RoomRoleAdmin).CanBan(nil))
+	assert.False(t, newAccess(group, models.RoomRoleAdmin).CanBan(admin))
+	assert.False(t, newAccess(group, models.RoomRoleMember).CanBan(nil))
+}
+
+func TestRoomAccessArchived(t *testing.T) {
+	now := time.Now()
+	room := models.ChatRoom{Type: "group", ArchivedAt: &now}
+
+	admin := newAccess(room, models.RoomRoleAdmin)
+	assert.True(t, admin.CanView())
+	assert.False(t, admin.CanPostMessage())
+	assert.False(t, admin.CanReact())
+	assert.False(t, admin.CanInvite())
+	assert.False(t, admin.CanManageInvites())
+	assert.True(t, admin.CanEditRoom())
+	assert.False(t, admin.CanDeleteRoom())
+	assert.True(t, newAccess(room, models.RoomRoleOwner).CanDeleteRoom())
+}
+
+func TestRoomAccessVisibility(t *testing.T) {
+	public := models.ChatRoom{Type: "group", Visibility: models.RoomVisibilityPublic}
+	assert.True(t, newAccess(public, "").CanJoin())
+	assert.False(t, newAccess(public, "").CanRequestJoin())
+
+	request := models.ChatRoom{Type: "group", Visibility: models.RoomVisibilityRequestToJoin}
+	assert.False(t, newAccess(request, "").CanJoin())
+	assert.True(t, newAccess(request, "").CanRequestJoin())
+	assert.False(t, newAccess(request, models.RoomRoleMember).CanRequestJoin())
+	assert.True(t, newAccess(request, models.RoomRoleAdmin).CanReviewJoinRequests())
+	assert.False(t, newAccess(request, models.RoomRoleMember).CanReviewJoinRequests())
+
+	inviteOnly := models.ChatRoom{Type: "group", Visibility: models.RoomVisibilityInviteOnly}
+	assert.False(t, newAccess(inviteOnly, "").CanJoin())
+	assert.False(t, newAccess(inviteOnly, "").CanRequestJoin())
+
+	// 归档的公开房间不能再加入
+	now := time.Now()
+	public.ArchivedAt = &now
+	assert.False(t, newAccess(public, "").CanJoin())
+}
+
+func TestRoomAccessDeleteMessage(t *testing.T) {
+	group := models.ChatRoom{ID: 1, Type: "group"}
+	own := &models.Message{RoomID: 1, SenderID: 10}
+	other := &models.Message{RoomID: 1, SenderID: 20}
+
+	member := newAccess(group, models.RoomRoleMember)
+	member.Member.UserID = 10
+	assert.True(t, member.CanDeleteMessage(own))
+	assert.False(t, member.CanDeleteMessage(other))
+
+	admin := newAccess(group, models.RoomRoleAdmin)
+	assert.True(t, admin.CanDeleteMessage(other))
+	assert.False(t, admin.CanDeleteMessage(&models.Message{RoomID: 2, SenderID: 20}))
+
+	// 单聊中只能删除自己的消息
+	single := newAccess(models.ChatRoom{ID: 1, Type: "single"}, models.RoomRoleOwner)
+	assert.False(t, single.CanDeleteMessage(other))
+
+	assert.False(t, newAccess(group, "").CanDeleteMessage(other))
+}
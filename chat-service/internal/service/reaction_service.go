@@ -0,0 +1,240 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidEmoji = errors.New("无效的表情")
+
+// maxEmojiRunes 组合表情（如家庭、肤色）由多个码点组成，限制码点数而不是字符数
+const maxEmojiRunes = 16
+
+// ReactionChange 表情回应变化后的结果，Changed为false表示重复添加或删除不存在的回应
+type ReactionChange struct {
+	RoomID    uint   `json:"room_id"`
+	MessageID uint   `json:"message_id"`
+	UserID    uint   `json:"user_id"`
+	Emoji     string `json:"emoji"`
+	Count     int64  `json:"count"` // 变化后该表情的回应人数
+	Changed   bool   `json:"-"`
+}
+
+// AddReaction 对消息添加表情回应，重复添加时不报错
+func (s *MessageService) AddReaction(messageID, userID uint, emoji string) (*ReactionChange, error) {
+	message, err := loadReactable(messageID, userID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	result := database.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&models.MessageReaction{
+		MessageID: message.ID,
+		UserID:    userID,
+		Emoji:     emoji,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return newReactionChange(message, userID, emoji, result.RowsAffected > 0)
+}
+
+// RemoveReaction 取消表情回应，没有回应过时不报错
+func (s *MessageService) RemoveReaction(messageID, userID uint, emoji string) (*ReactionChange, error) {
+	message, err := loadReactable(messageID, userID, emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	result := database.GetDB().
+		Where("message_id = ? AND user_id = ? AND emoji = ?", message.ID, userID, emoji).
+		Delete(&models.MessageReaction{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return newReactionChange(message, userID, emoji, result.RowsAffected > 0)
+}
+
+// GetReactionSummaries 按消息汇总表情回应，同一消息的表情按第一次回应的先后排序
+func (s *MessageService) GetReactionSummaries(messageIDs []uint, userID uint) (map[uint][]models.ReactionSummary, error) {
+	summaries := make(map[uint][]models.ReactionSummary)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	var rows []struct {
+		MessageID   uint
+		Emoji       string
+		Count       int64
+		ReactedByMe bool
+	}
+	err := database.GetDB().Model(&models.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, MAX(user_id = ?) AS reacted_by_me", userID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("MIN(id)").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		summaries[row.MessageID] = append(summaries[row.MessageID], models.ReactionSummary{
+			Emoji:       row.Emoji,
+			Count:       row.Count,
+			ReactedByMe: row.ReactedByMe,
+		})
+	}
+	return summaries, nil
+}
+
+// attachReactions 为消息列表填充表情回应，已删除的消息不显示回应
+func (s *MessageService) attachReactions(messages []models.Message, userID uint) error {
+	ids := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		if !message.IsDeleted {
+			ids = append(ids, message.ID)
+		}
+	}
+
+	summaries, err := s.GetReactionSummaries(ids, userID)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+	}
+	return nil
+}
+
+// loadReactable 校验表情并加载可以回应的消息，不是房间成员时与消息不存在返回相同的错误
+func loadReactable(messageID, userID uint, emoji string) (*models.Message, error) {
+	if err := validateEmoji(emoji); err != nil {
+		return nil, err
+	}
+
+	var message models.Message
+	err := database.GetDB().Where("id = ? AND is_deleted = false", messageID).First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := GetRoomAccess(userID, message.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !access.IsMember() {
+		return nil, ErrMessageNotFound
+	}
+	if !access.CanReact() {
+		return nil, ErrRoomArchived
+	}
+	return &message, nil
+}
+
+func newReactionChange(message *models.Message, userID uint, emoji string, changed bool) (*ReactionChange, error) {
+	change := &ReactionChange{
+		RoomID:    message.RoomID,
+		MessageID: message.ID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Changed:   changed,
+	}
+	err := database.GetDB().Model(&models.MessageReaction{}).
+		Where("message_id = ? AND emoji = ?", message.ID, emoji).
+		Count(&change.Count).Error
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// validateEmoji 表情必须由emoji码点组成，可以带肤色、变体选择符和零宽连接符组成组合表情，
+// 也支持国旗和数字键帽。长度不超过数据库字段
+func validateEmoji(emoji string) error {
+	if emoji == "" || len(emoji) > 64 || !utf8.ValidString(emoji) {
+		return ErrInvalidEmoji
+	}
+	if utf8.RuneCountInString(emoji) > maxEmojiRunes {
+		return ErrInvalidEmoji
+	}
+
+	// 数字、#和*只有后面跟着键帽符号时才是表情
+	keycap := strings.ContainsRune(emoji, '\u20e3')
+	hasBase := false
+	for _, r := range emoji {
+		switch {
+		case unicode.Is(emojiModifiers, r):
+		case unicode.Is(emojiBases, r):
+			hasBase = true
+		case keycap && (r >= '0' && r <= '9' || r == '#' || r == '*'):
+			hasBase = true
+		default:
+			return ErrInvalidEmoji
+		}
+	}
+	if !hasBase {
+		return ErrInvalidEmoji
+	}
+	return nil
+}
+
+// emojiBases 可以单独显示为表情的码点，近似Unicode的Extended_Pictographic和国旗字母
+var emojiBases = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00a9, Hi: 0x00ae, Stride: 5},
+		{Lo: 0x203c, Hi: 0x203c, Stride: 1},
+		{Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1},
+		{Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21a9, Hi: 0x21aa, Stride: 1},
+		{Lo: 0x231a, Hi: 0x231b, Stride: 1},
+		{Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x23cf, Hi: 0x23cf, Stride: 1},
+		{Lo: 0x23e9, Hi: 0x23f3, Stride: 1},
+		{Lo: 0x23f8, Hi: 0x23fa, Stride: 1},
+		{Lo: 0x24c2, Hi: 0x24c2, Stride: 1},
+		{Lo: 0x25aa, Hi: 0x25ab, Stride: 1},
+		{Lo: 0x25b6, Hi: 0x25b6, Stride: 1},
+		{Lo: 0x25c0, Hi: 0x25c0, Stride: 1},
+		{Lo: 0x25fb, Hi: 0x25fe, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27bf, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2b05, Hi: 0x2b07, Stride: 1},
+		{Lo: 0x2b1b, Hi: 0x2b1c, Stride: 1},
+		{Lo: 0x2b50, Hi: 0x2b55, Stride: 5},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1},
+		{Lo: 0x303d, Hi: 0x303d, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f000, Hi: 0x1f0ff, Stride: 1},
+		{Lo: 0x1f10d, Hi: 0x1f1ff, Stride: 1}, // 含国旗使用的区域指示字母
+		{Lo: 0x1f201, Hi: 0x1f2ff, Stride: 1},
+		{Lo: 0x1f300, Hi: 0x1faff, Stride: 1},
+	},
+	LatinOffset: 1,
+}
+
+// emojiModifiers 只能附加在表情上的码点：键帽、零宽连接符、变体选择符、肤色和旗帜的标签字符
+var emojiModifiers = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x200d, Hi: 0x200d, Stride: 1},
+		{Lo: 0x20e3, Hi: 0x20e3, Stride: 1},
+		{Lo: 0xfe0e, Hi: 0xfe0f, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f3fb, Hi: 0x1f3ff, Stride: 1},
+		{Lo: 0xe0020, Hi: 0xe007f, Stride: 1},
+	},
+}
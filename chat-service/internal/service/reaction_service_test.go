@@ -0,0 +1,33 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEmoji(t *testing.T) {
+	assert.NoError(t, validateEmoji("👍"))
+	assert.NoError(t, validateEmoji("👍🏽"))
+	assert.NoError(t, validateEmoji("👨‍👩‍👧‍👦"))
+	assert.NoError(t, validateEmoji("❤️"))
+	assert.NoError(t, validateEmoji("1️⃣"))
+	assert.NoError(t, validateEmoji("🇨🇳"))
+	assert.NoError(t, validateEmoji("🏴\U000e0067\U000e0062\U000e0073\U000e0063\U000e0074\U000e007f"))
+
+	assert.ErrorIs(t, validateEmoji(""), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji("👍 👍"), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji("a\nb"), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji(string([]byte{0xff})), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji(strings.Repeat("❤", maxEmojiRunes+1)), ErrInvalidEmoji)
+
+	// 只接受emoji码点，普通文字、短代码和单独的组合符号都不是表情
+	assert.ErrorIs(t, validateEmoji("lol"), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji(":thumbsup:"), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji(":anything:"), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji("好"), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji("👍a"), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji("1"), ErrInvalidEmoji)
+	assert.ErrorIs(t, validateEmoji("\u200d\ufe0f"), ErrInvalidEmoji)
+}
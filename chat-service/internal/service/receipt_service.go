@@ -0,0 +1,108 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReadReceipt 成员的已读或送达位置发生了变化
+type ReadReceipt struct {
+	RoomID    uint   `json:"room_id"`
+	UserID    uint   `json:"user_id"`
+	MessageID uint   `json:"message_id"`
+	Status    string `json:"status"` // delivered, read
+}
+
+// MessageReceipt 某条消息的一个接收者的回执
+type MessageReceipt struct {
+	User     models.User `json:"user"`
+	LastRead time.Time   `json:"last_read"`
+}
+
+// AckMessage 确认房间中messageID及之前的消息已送达或已读，位置只会前进。已读同时意味着已送达。
+// 返回的回执为nil表示位置没有变化或用户关闭了已读回执，不需要广播
+func (s *MessageService) AckMessage(userID, roomID, messageID uint, status string) (*ReadReceipt, error) {
+	var message models.Message
+	err := database.GetDB().Select("id, room_id, created_at").
+		Where("id = ? AND room_id = ?", messageID, roomID).
+		First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB().Model(&models.RoomMember{}).Where("room_id = ? AND user_id = ?", roomID, userID)
+	var result *gorm.DB
+	if status == models.ReceiptRead {
+		result = db.Where("last_read_message_id < ?", messageID).Updates(map[string]interface{}{
+			"last_read_message_id":      messageID,
+			"last_delivered_message_id": gorm.Expr("GREATEST(last_delivered_message_id, ?)", messageID),
+			"last_read":                 gorm.Expr("GREATEST(COALESCE(last_read, ?), ?)", message.CreatedAt, message.CreatedAt),
+		})
+	} else {
+		result = db.Where("last_delivered_message_id < ?", messageID).
+			Update("last_delivered_message_id", messageID)
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, s.checkMember(userID, roomID)
+	}
+
+	var hidden bool
+	if err := database.GetDB().Model(&models.User{}).Where("id = ?", userID).
+		Pluck("hide_read_receipts", &hidden).Error; err != nil {
+		return nil, err
+	}
+	if hidden {
+		return nil, nil
+	}
+	return &ReadReceipt{RoomID: roomID, UserID: userID, MessageID: messageID, Status: status}, nil
+}
+
+// GetMessageReceipts 获取已读和已送达（未读）某条消息的成员，不包括发送者和关闭了已读回执的成员
+func (s *MessageService) GetMessageReceipts(message *models.Message) (readBy, deliveredTo []MessageReceipt, err error) {
+	var members []models.RoomMember
+	err = database.GetDB().Preload("User").
+		Joins("JOIN users ON users.id = room_members.user_id").
+		Where("room_members.room_id = ? AND room_members.user_id != ? AND users.hide_read_receipts = false", message.RoomID, message.SenderID).
+		Where("room_members.last_delivered_message_id >= ? OR room_members.last_read_message_id >= ?", message.ID, message.ID).
+		Order("room_members.last_read DESC").
+		Find(&members).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	readBy = []MessageReceipt{}
+	deliveredTo = []MessageReceipt{}
+	for _, member := range members {
+		receipt := MessageReceipt{User: member.User, LastRead: member.LastRead}
+		if member.LastReadMessageID >= message.ID {
+			readBy = append(readBy, receipt)
+		} else {
+			deliveredTo = append(deliveredTo, receipt)
+		}
+	}
+	return readBy, deliveredTo, nil
+}
+
+// checkMember 回执位置没有变化时区分是否是房间成员
+func (s *MessageService) checkMember(userID, roomID uint) error {
+	var count int64
+	if err := database.GetDB().Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotRoomMember
+	}
+	return nil
+}
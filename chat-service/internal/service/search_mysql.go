@@ -0,0 +1,50 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"strings"
+)
+
+// MySQLSearchIndex 使用messages表上的FULLTEXT索引（ngram分词，支持中文）搜索，
+// 索引由MySQL随写入自动维护，Index和Remove不需要做任何事
+type MySQLSearchIndex struct{}
+
+func (MySQLSearchIndex) Search(query *SearchQuery) ([]uint, error) {
+	db := database.GetDB().Model(&models.Message{}).
+		Where("MATCH(content) AGAINST(? IN BOOLEAN MODE)", booleanQuery(query.Terms)).
+		Where("room_id IN ? AND is_deleted = false AND type = ?", query.RoomIDs, "text")
+	if query.SenderID != 0 {
+		db = db.Where("sender_id = ?", query.SenderID)
+	}
+	if query.From != nil {
+		db = db.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		db = db.Where("created_at < ?", *query.To)
+	}
+	if query.Cursor != 0 {
+		db = db.Where("id < ?", query.Cursor)
+	}
+
+	var ids []uint
+	err := db.Order("id DESC").Limit(query.Limit).Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (MySQLSearchIndex) Index(message *models.Message) error {
+	return nil
+}
+
+func (MySQLSearchIndex) Remove(messageID uint) error {
+	return nil
+}
+
+// booleanQuery 每个关键词都必须出现，作为短语匹配，避免用户输入的+-*等被当成运算符
+func booleanQuery(terms []string) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		parts = append(parts, `+"`+strings.ReplaceAll(term, `"`, " ")+`"`)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"errors"
+	"html"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrSearchQueryTooShort = errors.New("搜索关键词至少需要两个字")
+
+// minSearchTermRunes 与MySQL ngram_token_size的默认值一致，更短的词无法命中索引
+const minSearchTermRunes = 2
+
+// snippetRadius 摘要中关键词前后保留的字数
+const snippetRadius = 30
+
+// SearchQuery 交给搜索索引执行的查询，RoomIDs已限定为用户所在的房间
+type SearchQuery struct {
+	Terms    []string
+	RoomIDs  []uint
+	SenderID uint
+	From     *time.Time
+	To       *time.Time
+	Cursor   uint // 只返回ID小于Cursor的消息，0表示从最新的开始
+	Limit    int
+}
+
+// SearchIndex 消息搜索索引，默认使用MySQL FULLTEXT索引，可以通过SetSearchIndex替换为外部搜索引擎
+type SearchIndex interface {
+	// Search 返回匹配的未删除文本消息ID，按ID从大到小排列，最多Limit个
+	Search(query *SearchQuery) ([]uint, error)
+	// Index 消息发送或编辑后调用
+	Index(message *models.Message) error
+	// Remove 消息为所有人删除后调用
+	Remove(messageID uint) error
+}
+
+var searchIndex SearchIndex = MySQLSearchIndex{}
+
+// SetSearchIndex 替换消息搜索使用的索引，需要在启动时调用
+func SetSearchIndex(index SearchIndex) {
+	searchIndex = index
+}
+
+// SearchOptions 搜索条件，RoomID和SenderID为0表示不限制
+type SearchOptions struct {
+	Query    string
+	RoomID   uint
+	SenderID uint
+	From     *time.Time
+	To       *time.Time
+	Cursor   uint
+	PageSize int
+}
+
+// SearchResult 搜索结果，Snippet为HTML转义后用<mark>标出关键词的摘要
+type SearchResult struct {
+	Message models.Message `json:"message"`
+	Snippet string         `json:"snippet"`
+}
+
+// SearchService 消息全文搜索
+type SearchService struct{}
+
+func NewSearchService() *SearchService {
+	return &SearchService{}
+}
+
+// SearchMessages 在用户所在的房间中搜索消息，返回结果和下一页的游标，没有更多结果时游标为0
+func (s *SearchService) SearchMessages(userID uint, opts SearchOptions) ([]SearchResult, uint, error) {
+	terms := parseSearchTerms(opts.Query)
+	if len(terms) == 0 {
+		return nil, 0, ErrSearchQueryTooShort
+	}
+
+	// 已删除的房间只软删除了房间本身，成员记录仍在，需要排除
+	var roomIDs []uint
+	db := database.GetDB().Model(&models.RoomMember{}).
+		Joins("JOIN chat_rooms ON chat_rooms.id = room_members.room_id AND chat_rooms.deleted_at IS NULL").
+		Where("room_members.user_id = ?", userID)
+	if opts.RoomID != 0 {
+		db = db.Where("room_members.room_id = ?", opts.RoomID)
+	}
+	if err := db.Pluck("room_members.room_id", &roomIDs).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(roomIDs) == 0 {
+		if opts.RoomID != 0 {
+			return nil, 0, ErrNotRoomMember
+		}
+		return []SearchResult{}, 0, nil
+	}
+
+	// 多取一条判断是否还有下一页
+	ids, err := searchIndex.Search(&SearchQuery{
+		Terms:    terms,
+		RoomIDs:  roomIDs,
+		SenderID: opts.SenderID,
+		From:     opts.From,
+		To:       opts.To,
+		Cursor:   opts.Cursor,
+		Limit:    opts.PageSize + 1,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	var nextCursor uint
+	if len(ids) > opts.PageSize {
+		ids = ids[:opts.PageSize]
+		nextCursor = ids[len(ids)-1]
+	}
+	if len(ids) == 0 {
+		return []SearchResult{}, 0, nil
+	}
+
+	// 外部索引可能有延迟，以数据库中的状态为准，同时排除用户仅为自己删除的消息
+	var messages []models.Message
+	err = database.GetDB().Preload("Sender").
+		Where("id IN ? AND room_id IN ? AND is_deleted = false", ids, roomIDs).
+		Where("NOT EXISTS (SELECT 1 FROM hidden_messages WHERE hidden_messages.message_id = messages.id AND hidden_messages.user_id = ?)", userID).
+		Order("id DESC").
+		Find(&messages).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]SearchResult, 0, len(messages))
+	for _, message := range messages {
+		results = append(results, SearchResult{
+			Message: message,
+			Snippet: highlightSnippet(message.Content, terms),
+		})
+	}
+	return results, nextCursor, nil
+}
+
+// indexMessage 更新搜索索引，失败时只记录日志，不影响消息本身
+func indexMessage(message *models.Message) {
+	if err := searchIndex.Index(message); err != nil {
+		log.Printf("更新搜索索引失败: %v", err)
+	}
+}
+
+// removeFromIndex 从搜索索引中删除消息
+func removeFromIndex(messageID uint) {
+	if err := searchIndex.Remove(messageID); err != nil {
+		log.Printf("删除搜索索引失败: %v", err)
+	}
+}
+
+// parseSearchTerms 按空白拆分关键词并去重，去掉引号和过短的词
+func parseSearchTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		term = strings.Trim(term, `"`)
+		if utf8.RuneCountInString(term) < minSearchTermRunes {
+			continue
+		}
+		key := strings.ToLower(term)
+		if !seen[key] {
+			seen[key] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// highlightSnippet 截取第一个关键词附近的内容作为摘要，转义HTML并用<mark>标出所有关键词
+func highlightSnippet(content string, terms []string) string {
+	runes := []rune(content)
+	lower := []rune(strings.ToLower(content))
+
+	// 按字符而不是字节定位，避免截断多字节字符
+	first := -1
+	for _, term := range terms {
+		if i := indexRunes(lower, []rune(strings.ToLower(term)), 0); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	start, end := 0, len(runes)
+	if first >= 0 {
+		if first > snippetRadius {
+			start = first - snippetRadius
+		}
+		if first+snippetRadius*2 < end {
+			end = first + snippetRadius*2
+		}
+	} else if end > snippetRadius*2 {
+		end = snippetRadius * 2
+	}
+
+	// 标记每个字符是否属于某个关键词
+	marked := make([]bool, end-start)
+	for _, term := range terms {
+		t := []rune(strings.ToLower(term))
+		for i := indexRunes(lower[:end], t, start); i >= 0; i = indexRunes(lower[:end], t, i+len(t)) {
+			for j := i; j < i+len(t); j++ {
+				marked[j-start] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i-start] && (i == start || !marked[i-start-1]) {
+			b.WriteString("<mark>")
+		}
+		b.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i-start] && (i == end-1 || !marked[i-start+1]) {
+			b.WriteString("</mark>")
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// indexRunes 从from开始查找sub第一次出现的位置，没有时返回-1
+func indexRunes(s, sub []rune, from int) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := from; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchTerms(t *testing.T) {
+	assert.Equal(t, []string{"周报", "deploy"}, parseSearchTerms(`  周报 a "deploy" 周报 Deploy `))
+	assert.Empty(t, parseSearchTerms("a 好 \"\""))
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	assert.Equal(t, "明天<mark>开会</mark>讨论<mark>周报</mark>", highlightSnippet("明天开会讨论周报", []string{"开会", "周报"}))
+
+	// 大小写不敏感，内容中的HTML被转义
+	assert.Equal(t, "&lt;b&gt;<mark>Deploy</mark>&lt;/b&gt; 完成", highlightSnippet("<b>Deploy</b> 完成", []string{"deploy"}))
+
+	// 长内容只保留关键词附近的部分
+	content := strings.Repeat("前", 50) + "关键词" + strings.Repeat("后", 100)
+	snippet := highlightSnippet(content, []string{"关键词"})
+	assert.True(t, strings.HasPrefix(snippet, "…"+strings.Repeat("前", snippetRadius)+"<mark>关键词</mark>"))
+	assert.True(t, strings.HasSuffix(snippet, "后…"))
+
+	// 外部索引可能按分词命中，内容中找不到原词时返回开头部分
+	assert.Equal(t, "没有匹配", highlightSnippet("没有匹配", []string{"其他"}))
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"chat-service/internal/database"
+	"chat-service/internal/middleware"
+	"chat-service/internal/models"
+	"chat-service/pkg/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const maxPersonalTokens = 50
+
+var (
+	ErrPersonalTokenNotFound = errors.New("token不存在")
+	ErrPersonalTokenLimit    = fmt.Errorf("每个用户最多创建%d个token", maxPersonalTokens)
+	ErrInvalidScope          = errors.New("无效的权限")
+)
+
+type PersonalTokenService struct{}
+
+func NewPersonalTokenService() *PersonalTokenService {
+	return &PersonalTokenService{}
+}
+
+// CreateToken 创建个人访问token，明文只在创建时返回一次
+func (s *PersonalTokenService) CreateToken(userID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.PersonalAccessToken, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !middleware.ValidScope(scope) {
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+
+	var count int64
+	if err := database.GetDB().Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count).Error; err != nil {
+		return "", nil, err
+	}
+	if count >= maxPersonalTokens {
+		return "", nil, ErrPersonalTokenLimit
+	}
+
+	raw := middleware.PersonalTokenPrefix + utils.GenerateRandomString(40)
+	token := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: utils.HashToken(raw),
+		Prefix:    raw[:len(middleware.PersonalTokenPrefix)+4],
+		Scopes:    strings.Join(normalized, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := database.GetDB().Create(token).Error; err != nil {
+		return "", nil, err
+	}
+	return raw, token, nil
+}
+
+// GetTokens 获取用户未吊销的token列表
+func (s *PersonalTokenService) GetTokens(userID uint) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := database.GetDB().Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeToken 吊销用户的token，吊销后立即失效
+func (s *PersonalTokenService) RevokeToken(userID, tokenID uint) error {
+	result := database.GetDB().Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPersonalTokenNotFound
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"chat-service/pkg/cache"
+	"chat-service/pkg/totp"
+	"chat-service/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	recoveryCodeCount    = 10
+	challengeTTL         = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("两步验证已开启")
+	ErrTwoFactorNotEnabled     = errors.New("两步验证未开启")
+	ErrTwoFactorNotSetup       = errors.New("请先生成两步验证密钥")
+	ErrInvalidTwoFactorCode    = errors.New("验证码错误")
+	ErrChallengeInvalid        = errors.New("登录验证已失效，请重新登录")
+)
+
+// twoFactorChallengeClaims 密码校验通过后签发的短期挑战token，只能用于完成两步验证
+type twoFactorChallengeClaims struct {
+	UserID     uint   `json:"uid"`
+	LoginName  string `json:"login,omitempty"`
+	DeviceName string `json:"device,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TwoFactorChallenge 挑战token中记录的登录信息
+type TwoFactorChallenge struct {
+	id         string
+	UserID     uint
+	LoginName  string // 登录时使用的用户名，验证码错误同样计入该用户名的登录失败次数
+	DeviceName string
+}
+
+type TwoFactorService struct{}
+
+func NewTwoFactorService() *TwoFactorService {
+	return &TwoFactorService{}
+}
+
+// Setup 生成新的TOTP密钥并返回otpauth地址，调用Confirm后才会生效
+func (s *TwoFactorService) Setup(userID uint, cfg *config.Config) (string, string, error) {
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled {
+		return "", "", ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := database.GetDB().Model(&user).Update("totp_secret", secret).Error; err != nil {
+		return "", "", err
+	}
+
+	return secret, totp.URI(cfg.Auth.TOTPIssuer, user.Username, secret), nil
+}
+
+// Confirm 使用验证码确认密钥并开启两步验证，返回一次性恢复码
+func (s *TwoFactorService) Confirm(userID uint, code string) ([]string, error) {
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotSetup
+	}
+	if err := s.verifyTOTP(&user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// Disable 校验密码和验证码（或恢复码）后关闭两步验证
+func (s *TwoFactorService) Disable(userID uint, password, code string) error {
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+	if err := s.VerifyCode(&user, code); err != nil {
+		return err
+	}
+
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled": false,
+			"totp_secret":  "",
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes 校验验证码后生成新的恢复码，旧的恢复码全部作废
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err := s.verifyTOTP(&user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = s.replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// VerifyCode 校验TOTP验证码，失败时再尝试作为恢复码使用
+func (s *TwoFactorService) VerifyCode(user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.verifyTOTP(user, code)
+	}
+	return s.useRecoveryCode(user.ID, code)
+}
+
+// CreateChallenge 为已通过密码校验的用户签发两步验证挑战token
+func (s *TwoFactorService) CreateChallenge(userID uint, loginName, deviceName string, cfg *config.Config) (string, error) {
+	now := time.Now()
+	claims := twoFactorChallengeClaims{
+		UserID:     userID,
+		LoginName:  loginName,
+		DeviceName: deviceName,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        utils.GenerateRandomString(32),
+			ExpiresAt: jwt.NewNumericDate(now.Add(challengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(challengeKey(cfg))
+}
+
+// ParseChallenge 校验挑战token的签名和有效期，返回其中记录的登录信息
+func (s *TwoFactorService) ParseChallenge(token string, cfg *config.Config) (*TwoFactorChallenge, error) {
+	parsed, err := jwt.ParseWithClaims(token, &twoFactorChallengeClaims{}, func(t *jwt.Token) (interface{}, error) {
+		return challengeKey(cfg), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsed.Valid {
+		return nil, ErrChallengeInvalid
+	}
+	claims := parsed.Claims.(*twoFactorChallengeClaims)
+	return &TwoFactorChallenge{
+		id:         claims.ID,
+		UserID:     claims.UserID,
+		LoginName:  claims.LoginName,
+		DeviceName: claims.DeviceName,
+	}, nil
+}
+
+// CompleteChallenge 校验验证码，成功后返回用户。
+// 每个挑战token最多尝试maxChallengeAttempts次，成功后立即作废
+func (s *TwoFactorService) CompleteChallenge(challenge *TwoFactorChallenge, code string) (*models.User, error) {
+	ctx := context.Background()
+	attempts, err := cache.IncrWithTTL(ctx, "2fa_challenge:"+challenge.id, challengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if attempts > maxChallengeAttempts {
+		return nil, ErrChallengeInvalid
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, challenge.UserID).Error; err != nil {
+		return nil, ErrChallengeInvalid
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrChallengeInvalid
+	}
+	if err := s.VerifyCode(&user, code); err != nil {
+		return nil, err
+	}
+
+	// 挑战token只能使用一次
+	fresh, err := cache.Throttle(ctx, "2fa_challenge_used:"+challenge.id, challengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrChallengeInvalid
+	}
+	return &user, nil
+}
+
+// verifyTOTP 校验TOTP验证码，同一个时间步的验证码只能使用一次
+func (s *TwoFactorService) verifyTOTP(user *models.User, code string) error {
+	step, ok := totp.Validate(user.TOTPSecret, strings.TrimSpace(code), time.Now(), 1)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	fresh, err := cache.Throttle(context.Background(),
+		fmt.Sprintf("totp_used:%d:%d", user.ID, step), 3*totp.Period*time.Second)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) useRecoveryCode(userID uint, code string) error {
+	result := database.GetDB().Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := utils.GenerateRandomString(10)
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		if err := tx.Create(&models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(raw),
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// challengeKey 挑战token使用独立派生的密钥，避免被当作access token使用
+func challengeKey(cfg *config.Config) []byte {
+	return []byte(cfg.JWT.Secret + ":2fa-challenge")
+}
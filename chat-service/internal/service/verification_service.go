@@ -0,0 +1,191 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/database"
+	"chat-service/internal/models"
+	"chat-service/pkg/cache"
+	"chat-service/pkg/mail"
+	"chat-service/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrVerifyTokenInvalid = errors.New("验证链接无效或已过期")
+	ErrVerifyThrottled    = errors.New("验证邮件发送过于频繁，请稍后再试")
+	ErrEmailInUse         = errors.New("该邮箱已被使用")
+)
+
+// emailVerifyClaims 邮箱验证链接中的签名内容，绑定用户和当时的邮箱地址
+type emailVerifyClaims struct {
+	UserID uint   `json:"uid"`
+	Email  string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+type VerificationService struct{}
+
+func NewVerificationService() *VerificationService {
+	return &VerificationService{}
+}
+
+// SendVerificationEmail 向email发送签名的验证链接，email为用户的注册邮箱或待验证的新邮箱
+func (s *VerificationService) SendVerificationEmail(user *models.User, email string, cfg *config.Config) error {
+	now := time.Now()
+	claims := emailVerifyClaims{
+		UserID: user.ID,
+		Email:  email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(cfg.Auth.VerifyExpireHour) * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(verifyKey(cfg))
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", strings.TrimRight(cfg.Server.PublicURL, "/"), token)
+	body := fmt.Sprintf("%s，您好：\n\n请在%d小时内打开以下链接验证您的邮箱：\n%s\n\n如果这不是您本人的操作，请忽略此邮件。",
+		user.Nickname, cfg.Auth.VerifyExpireHour, link)
+
+	go func() {
+		if err := mail.Send(email, "验证邮箱", body); err != nil {
+			log.Printf("验证邮件发送失败: %v", err)
+		}
+	}()
+	return nil
+}
+
+// VerifyEmail 校验验证链接。注册邮箱的链接将用户状态置为active，新邮箱的链接用它替换原邮箱。
+// 链接签发后邮箱被修改过则失效，新邮箱在此期间被其他账号使用时返回ErrEmailInUse
+func (s *VerificationService) VerifyEmail(token string, cfg *config.Config) (*models.User, error) {
+	parsed, err := jwt.ParseWithClaims(token, &emailVerifyClaims{}, func(t *jwt.Token) (interface{}, error) {
+		return verifyKey(cfg), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsed.Valid {
+		return nil, ErrVerifyTokenInvalid
+	}
+	claims := parsed.Claims.(*emailVerifyClaims)
+
+	var user models.User
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, claims.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrVerifyTokenInvalid
+			}
+			return err
+		}
+
+		updates := map[string]interface{}{}
+		switch {
+		case claims.Email == user.Email:
+		case claims.Email == user.PendingEmail && user.PendingEmail != "":
+			if err := releaseEmail(tx, claims.Email, user.ID, &cfg.Auth); err != nil {
+				return err
+			}
+			user.Email = user.PendingEmail
+			user.PendingEmail = ""
+			updates["email"] = user.Email
+			updates["pending_email"] = ""
+		default:
+			return ErrVerifyTokenInvalid
+		}
+		if user.Status == models.UserStatusPendingVerification {
+			user.Status = models.UserStatusActive
+			updates["status"] = user.Status
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		err := tx.Model(&user).Updates(updates).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrEmailInUse
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ReleaseEmail 检查邮箱能否被userID使用（新注册时为0），邮箱仍被占用时返回ErrEmailInUse
+func (s *VerificationService) ReleaseEmail(email string, userID uint, cfg *config.Config) error {
+	return releaseEmail(database.GetDB(), email, userID, &cfg.Auth)
+}
+
+// releaseEmail 邮箱被过期未验证的注册占用时删除该注册以释放邮箱，避免他人抢注后真正的所有者无法注册。
+// 邮箱被其他账号正常使用时返回ErrEmailInUse
+func releaseEmail(tx *gorm.DB, email string, userID uint, cfg *config.AuthConfig) error {
+	var holder models.User
+	err := tx.Where("email = ?", email).First(&holder).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if holder.ID == userID {
+		return nil
+	}
+	if !unverifiedExpired(&holder, cfg, time.Now()) {
+		return ErrEmailInUse
+	}
+
+	// 登录过的账号即使未验证也不删除
+	var sessions int64
+	if err := tx.Model(&models.Session{}).Where("user_id = ?", holder.ID).Count(&sessions).Error; err != nil {
+		return err
+	}
+	if sessions > 0 {
+		return ErrEmailInUse
+	}
+	return tx.Unscoped().Delete(&holder).Error
+}
+
+// unverifiedExpired 要求验证邮箱时未验证的用户无法登录，验证链接过期后不再为其保留邮箱
+func unverifiedExpired(user *models.User, cfg *config.AuthConfig, now time.Time) bool {
+	if cfg == nil || !cfg.RequireEmailVerification || user.Status != models.UserStatusPendingVerification {
+		return false
+	}
+	return now.Sub(user.CreatedAt) > time.Duration(cfg.VerifyExpireHour)*time.Hour
+}
+
+// ResendVerification 重新发送注册邮箱或待验证新邮箱的验证邮件。按邮箱限流，邮箱不存在或已验证时同样返回nil
+func (s *VerificationService) ResendVerification(email string, cfg *config.Config) error {
+	interval := time.Duration(cfg.Auth.VerifyResendInterval) * time.Second
+	ok, err := cache.Throttle(context.Background(), "verify_email:"+utils.HashToken(strings.ToLower(email)), interval)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrVerifyThrottled
+	}
+
+	var user models.User
+	err = database.GetDB().
+		Where("(email = ? AND status = ?) OR pending_email = ?", email, models.UserStatusPendingVerification, email).
+		First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.SendVerificationEmail(&user, email, cfg)
+}
+
+// verifyKey 验证链接使用独立派生的密钥，避免与access token互相通用
+func verifyKey(cfg *config.Config) []byte {
+	return []byte(cfg.JWT.Secret + ":email-verification")
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"chat-service/internal/config"
+	"chat-service/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnverifiedExpired(t *testing.T) {
+	now := time.Now()
+	cfg := &config.AuthConfig{RequireEmailVerification: true, VerifyExpireHour: 24}
+	pending := &models.User{Status: models.UserStatusPendingVerification, CreatedAt: now.Add(-25 * time.Hour)}
+
+	assert.True(t, unverifiedExpired(pending, cfg, now))
+
+	// 验证链接未过期时仍为注册者保留邮箱
+	assert.False(t, unverifiedExpired(&models.User{Status: models.UserStatusPendingVerification, CreatedAt: now.Add(-time.Hour)}, cfg, now))
+
+	// 已验证的账号和不要求验证时未验证的账号都可以正常使用，不会被回收
+	assert.False(t, unverifiedExpired(&models.User{Status: models.UserStatusActive, CreatedAt: pending.CreatedAt}, cfg, now))
+	assert.False(t, unverifiedExpired(pending, &config.AuthConfig{VerifyExpireHour: 24}, now))
+	assert.False(t, unverifiedExpired(pending, nil, now))
+}
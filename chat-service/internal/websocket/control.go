@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"chat-service/pkg/cache"
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+)
+
+const controlChannel = "ws:control"
+
+// 需要在所有实例上执行的连接操作
+const (
+	controlRemoveUser = "remove_user" // 成员被移出或封禁
+	controlCloseRoom  = "close_room"  // 房间被删除
+	controlDisconnect = "disconnect"  // 会话被吊销
+)
+
+// controlEvent 在实例之间同步的连接控制操作。用户的连接可能分布在任意实例上，
+// 只在处理请求的实例上执行会让其他实例上的连接继续收到房间事件
+type controlEvent struct {
+	Action     string          `json:"action"`
+	RoomID     uint            `json:"room_id,omitempty"`
+	UserID     uint            `json:"user_id,omitempty"`
+	SessionIDs []uint          `json:"session_ids,omitempty"`
+	Notice     json.RawMessage `json:"notice,omitempty"` // 执行前发送给受影响连接的通知
+}
+
+// controlSubscribed 本实例是否已订阅控制频道，未订阅时发布的操作需要在本地直接执行
+var controlSubscribed atomic.Bool
+
+// publishControl 将控制操作发布给所有实例，本实例通过订阅收到后执行。Redis不可用时只在本实例执行
+func publishControl(event controlEvent) {
+	err := cache.Publish(context.Background(), controlChannel, event)
+	if err != nil {
+		log.Printf("发布连接控制事件失败: %v", err)
+	}
+	if err != nil || !controlSubscribed.Load() {
+		applyControl(event)
+	}
+}
+
+// subscribeControl 接收所有实例发布的控制操作并在本实例上执行
+func subscribeControl() {
+	pubsub, err := cache.Subscribe(context.Background(), controlChannel)
+	if err != nil {
+		log.Printf("订阅连接控制事件失败，只在本实例内执行: %v", err)
+		return
+	}
+	defer pubsub.Close()
+
+	controlSubscribed.Store(true)
+	defer controlSubscribed.Store(false)
+
+	for msg := range pubsub.Channel() {
+		var event controlEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			continue
+		}
+		applyControl(event)
+	}
+}
+
+// applyControl 对本实例上的连接执行控制操作
+func applyControl(event controlEvent) {
+	switch event.Action {
+	case controlRemoveUser:
+		if len(event.Notice) > 0 {
+			hub.SendToUser(event.UserID, event.Notice)
+		}
+		hub.RemoveUserFromRoom(event.RoomID, event.UserID)
+	case controlCloseRoom:
+		if len(event.Notice) > 0 {
+			hub.BroadcastToRoom(event.RoomID, event.Notice)
+		}
+		hub.CloseRoom(event.RoomID)
+	case controlDisconnect:
+		hub.DisconnectSessions(event.SessionIDs...)
+	}
+}
@@ -1,13 +1,17 @@
 package websocket
 
 import (
+	"chat-service/internal/config"
 	"chat-service/internal/database"
 	"chat-service/internal/models"
+	"chat-service/internal/service"
 	"chat-service/pkg/cache"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,12 +26,15 @@ var upgrader = websocket.Upgrader{
 }
 
 type Client struct {
-	ID     uint
-	ConnID string
-	Conn   *websocket.Conn
-	Send   chan []byte
-	Rooms  map[uint]bool
-	mu     sync.RWMutex
+	ID        uint
+	SessionID uint
+	ConnID    string
+	Conn      *websocket.Conn
+	Send      chan []byte
+	Rooms     map[uint]bool
+	cfg       *config.Config
+	typing    *typingLimiter
+	mu        sync.RWMutex
 }
 
 type Hub struct {
@@ -48,11 +55,14 @@ var hub = &Hub{
 }
 
 type WSMessage struct {
-	Type     string      `json:"type"`
-	RoomID   uint        `json:"room_id"`
-	SenderID uint        `json:"sender_id"`
-	Content  interface{} `json:"content"`
-	Time     time.Time   `json:"time"`
+	Type        string      `json:"type"`
+	RoomID      uint        `json:"room_id"`
+	SenderID    uint        `json:"sender_id"`
+	Content     interface{} `json:"content"`
+	Time        time.Time   `json:"time"`
+	MessageID   uint        `json:"message_id,omitempty"`
+	MessageType string      `json:"message_type,omitempty"` // text, system等，对应Message.Type
+	ReplyToID   *uint       `json:"reply_to_id,omitempty"`  // 回复的话题第一条消息ID
 }
 
 func (h *Hub) Run() {
@@ -157,12 +167,391 @@ func (h *Hub) BroadcastToRoom(roomID uint, message []byte) {
 	}
 }
 
+// BroadcastToRoomExcept 向房间内除指定用户以外的连接发送消息
+func (h *Hub) BroadcastToRoomExcept(roomID, userID uint, message []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.rooms[roomID] {
+		if client.ID == userID {
+			continue
+		}
+		select {
+		case client.Send <- message:
+		default:
+		}
+	}
+}
+
+// SendToUser 向用户的所有连接发送消息，不要求用户已加入房间
+func (h *Hub) SendToUser(userID uint, message []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.clients {
+		if client.ID != userID {
+			continue
+		}
+		select {
+		case client.Send <- message:
+		default:
+		}
+	}
+}
+
+// RemoveUserFromRoom 将用户的所有连接从房间中移除，之后不再收到该房间的广播
+func (h *Hub) RemoveUserFromRoom(roomID, userID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if room, ok := h.rooms[roomID]; ok {
+		for connID, client := range room {
+			if client.ID == userID {
+				delete(room, connID)
+				delete(client.Rooms, roomID)
+			}
+		}
+		if len(room) == 0 {
+			delete(h.rooms, roomID)
+		}
+	}
+
+	log.Printf("用户 %d 被移出房间 %d", userID, roomID)
+}
+
+// CloseRoom 将所有连接从房间中移除，用于房间被删除后
+func (h *Hub) CloseRoom(roomID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if room, ok := h.rooms[roomID]; ok {
+		for _, client := range room {
+			delete(client.Rooms, roomID)
+		}
+		delete(h.rooms, roomID)
+	}
+
+	log.Printf("房间 %d 已关闭", roomID)
+}
+
+// isInRoom 判断连接是否已加入房间。Rooms会被其他goroutine修改，需要在锁内读取
+func (h *Hub) isInRoom(client *Client, roomID uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return client.Rooms[roomID]
+}
+
+// DisconnectSessions 关闭属于指定会话的所有WebSocket连接
+func (h *Hub) DisconnectSessions(sessionIDs ...uint) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+
+	targets := make(map[uint]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		targets[id] = true
+	}
+
+	h.mu.RLock()
+	var clients []*Client
+	for _, client := range h.clients {
+		if client.SessionID != 0 && targets[client.SessionID] {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	// 关闭连接后readPump会退出并注销客户端
+	for _, client := range clients {
+		client.Conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session revoked"),
+			time.Now().Add(time.Second))
+		client.Conn.Close()
+		log.Printf("会话 %d 已吊销，断开连接: %s", client.SessionID, client.ConnID)
+	}
+}
+
+// DisconnectSessions 关闭所有实例上属于指定会话的WebSocket连接
+func DisconnectSessions(sessionIDs ...uint) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	publishControl(controlEvent{Action: controlDisconnect, SessionIDs: sessionIDs})
+}
+
+// BroadcastRoomEvent 向房间内的所有连接广播事件
+func BroadcastRoomEvent(roomID uint, eventType string, content interface{}) {
+	data, _ := json.Marshal(WSMessage{
+		Type:    eventType,
+		RoomID:  roomID,
+		Content: content,
+		Time:    time.Now(),
+	})
+	hub.BroadcastToRoom(roomID, data)
+}
+
+// BroadcastSystemMessage 将已保存的系统消息作为new_message广播到房间
+func BroadcastSystemMessage(msg *models.Message) {
+	if msg == nil {
+		return
+	}
+	data, _ := json.Marshal(WSMessage{
+		Type:        "new_message",
+		RoomID:      msg.RoomID,
+		SenderID:    msg.SenderID,
+		Content:     msg.Content,
+		Time:        msg.CreatedAt,
+		MessageID:   msg.ID,
+		MessageType: msg.Type,
+	})
+	hub.BroadcastToRoom(msg.RoomID, data)
+}
+
+// PublishMessage 广播新保存的消息并更新缓存和未读数。root为话题的第一条消息，
+// 不为空时同时广播话题的回复数变化，并通知话题的其他参与者
+func PublishMessage(msg *models.Message, root *models.Message) {
+	messageData := WSMessage{
+		Type:        "new_message",
+		RoomID:      msg.RoomID,
+		SenderID:    msg.SenderID,
+		Content:     msg.Content,
+		Time:        msg.CreatedAt,
+		MessageID:   msg.ID,
+		MessageType: msg.Type,
+		ReplyToID:   msg.ReplyToID,
+	}
+
+	data, _ := json.Marshal(messageData)
+	hub.BroadcastToRoom(msg.RoomID, data)
+
+	// 缓存消息
+	cache.CacheMessage(context.Background(), msg.RoomID, messageData)
+
+	// 更新未读消息计数
+	updateUnreadCounts(msg.RoomID, msg.SenderID, msg.ID)
+
+	// 被@的用户即使没有在连接中加入该房间也会收到通知
+	if strings.Contains(msg.Content, "@") {
+		mentions, err := service.NewMessageService().GetMentions(msg.ID)
+		if err != nil {
+			log.Printf("获取消息@记录失败: %v", err)
+		} else {
+			notifyMentions(msg, mentions)
+		}
+	}
+
+	if root == nil {
+		return
+	}
+
+	BroadcastRoomEvent(msg.RoomID, "thread_updated", gin.H{
+		"root_id":       root.ID,
+		"reply_count":   root.ReplyCount,
+		"last_reply_at": root.LastReplyAt,
+	})
+
+	participants, err := service.NewMessageService().GetThreadParticipants(root)
+	if err != nil {
+		log.Printf("获取话题参与者失败: %v", err)
+		return
+	}
+	for _, userID := range participants {
+		if userID == msg.SenderID {
+			continue
+		}
+		SendToUser(userID, WSMessage{
+			Type:        "thread_reply",
+			RoomID:      msg.RoomID,
+			SenderID:    msg.SenderID,
+			Content:     msg.Content,
+			Time:        msg.CreatedAt,
+			MessageID:   msg.ID,
+			MessageType: msg.Type,
+			ReplyToID:   msg.ReplyToID,
+		})
+	}
+}
+
+// notifyMentions 向消息中@到的用户发送mentioned事件
+func notifyMentions(msg *models.Message, mentions []models.MessageMention) {
+	for _, mention := range mentions {
+		SendToUser(mention.UserID, WSMessage{
+			Type:     "mentioned",
+			RoomID:   msg.RoomID,
+			SenderID: msg.SenderID,
+			Content: gin.H{
+				"kind":    mention.Kind,
+				"content": msg.Content,
+			},
+			Time:        msg.CreatedAt,
+			MessageID:   msg.ID,
+			MessageType: msg.Type,
+			ReplyToID:   msg.ReplyToID,
+		})
+	}
+}
+
+// PublishMessageEdited 广播消息被编辑，客户端按message_id原地更新，同时更新最近消息缓存。
+// mentions为本次编辑新增的@，只通知新被@到的用户
+func PublishMessageEdited(msg *models.Message, mentions []models.MessageMention) {
+	data, _ := json.Marshal(WSMessage{
+		Type:        "message_edited",
+		RoomID:      msg.RoomID,
+		SenderID:    msg.SenderID,
+		Content:     msg.Content,
+		Time:        *msg.EditedAt,
+		MessageID:   msg.ID,
+		MessageType: msg.Type,
+		ReplyToID:   msg.ReplyToID,
+	})
+	hub.BroadcastToRoom(msg.RoomID, data)
+
+	err := cache.UpdateCachedMessage(context.Background(), msg.RoomID, msg.ID, func(cached map[string]interface{}) {
+		cached["content"] = msg.Content
+		cached["edited_at"] = msg.EditedAt
+	})
+	if err != nil {
+		log.Printf("更新消息缓存失败: %v", err)
+	}
+
+	notifyMentions(msg, mentions)
+}
+
+// PublishMessageDeleted 广播消息已为所有人删除，并清除最近消息缓存中的内容。
+// root不为空时表示删除的是话题中的回复，同时广播话题的回复数变化
+func PublishMessageDeleted(msg *models.Message, root *models.Message) {
+	data, _ := json.Marshal(WSMessage{
+		Type:      "message_deleted",
+		RoomID:    msg.RoomID,
+		SenderID:  msg.SenderID,
+		Content:   gin.H{"scope": "everyone"},
+		Time:      time.Now(),
+		MessageID: msg.ID,
+		ReplyToID: msg.ReplyToID,
+	})
+	hub.BroadcastToRoom(msg.RoomID, data)
+
+	err := cache.UpdateCachedMessage(context.Background(), msg.RoomID, msg.ID, func(cached map[string]interface{}) {
+		cached["content"] = ""
+		cached["is_deleted"] = true
+	})
+	if err != nil {
+		log.Printf("更新消息缓存失败: %v", err)
+	}
+
+	if root != nil {
+		BroadcastRoomEvent(msg.RoomID, "thread_updated", gin.H{
+			"root_id":       root.ID,
+			"reply_count":   root.ReplyCount,
+			"last_reply_at": root.LastReplyAt,
+		})
+	}
+}
+
+// PublishReaction 广播表情回应的变化，eventType为reaction_added或reaction_removed。回应没有变化时不广播
+func PublishReaction(eventType string, change *service.ReactionChange) {
+	if !change.Changed {
+		return
+	}
+	data, _ := json.Marshal(WSMessage{
+		Type:      eventType,
+		RoomID:    change.RoomID,
+		SenderID:  change.UserID,
+		Content:   change,
+		Time:      time.Now(),
+		MessageID: change.MessageID,
+	})
+	hub.BroadcastToRoom(change.RoomID, data)
+}
+
+// PublishReadReceipt 广播成员的已读或送达位置
+func PublishReadReceipt(receipt *service.ReadReceipt) {
+	data, _ := json.Marshal(WSMessage{
+		Type:      "read_receipt",
+		RoomID:    receipt.RoomID,
+		SenderID:  receipt.UserID,
+		Content:   receipt,
+		Time:      time.Now(),
+		MessageID: receipt.MessageID,
+	})
+	hub.BroadcastToRoom(receipt.RoomID, data)
+}
+
+// SendToUser 向用户的所有连接发送事件
+func SendToUser(userID uint, msg WSMessage) {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	data, _ := json.Marshal(msg)
+	hub.SendToUser(userID, data)
+}
+
+// RemoveUserFromRoom 通知用户已被移出房间，并强制将其在所有实例上的连接从房间中移除
+func RemoveUserFromRoom(roomID, userID uint, eventType string, content interface{}) {
+	notice, _ := json.Marshal(WSMessage{
+		Type:    eventType,
+		RoomID:  roomID,
+		Content: content,
+		Time:    time.Now(),
+	})
+	publishControl(controlEvent{Action: controlRemoveUser, RoomID: roomID, UserID: userID, Notice: notice})
+	cache.RemoveUserFromRoom(context.Background(), roomID, userID)
+}
+
+// CloseRoom 通知所有实例上房间内的连接房间已删除，并将它们全部移出房间
+func CloseRoom(roomID uint, eventType string, content interface{}) {
+	notice, _ := json.Marshal(WSMessage{
+		Type:    eventType,
+		RoomID:  roomID,
+		Content: content,
+		Time:    time.Now(),
+	})
+	publishControl(controlEvent{Action: controlCloseRoom, RoomID: roomID, Notice: notice})
+	cache.ClearRoom(context.Background(), roomID)
+}
+
+// CreateTicket 为已认证的用户签发一次性的WebSocket连接票据
+func CreateTicket(c *gin.Context) {
+	ticket, err := cache.CreateWSTicket(c.Request.Context(), &cache.WSTicket{
+		UserID:    c.GetUint("user_id"),
+		SessionID: c.GetUint("session_id"),
+		TokenID:   c.GetString("token_id"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成连接票据失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"expires_in": int(cache.WSTicketTTL.Seconds()),
+	})
+}
+
+// HandleWebSocket 使用?ticket=中的一次性票据认证并升级为WebSocket连接
 func HandleWebSocket(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	if userID == 0 {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+	ctx := c.Request.Context()
+	ticket, err := cache.ConsumeWSTicket(ctx, c.Query("ticket"))
+	if err != nil {
+		if errors.Is(err, cache.ErrWSTicketInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "认证服务暂不可用"})
+		return
+	}
+
+	// 票据签发后会话可能已被吊销
+	revoked, err := cache.IsTokenRevoked(ctx, ticket.TokenID, ticket.SessionID)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "认证服务暂不可用"})
 		return
 	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "token已失效"})
+		return
+	}
+	userID := ticket.UserID
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -172,15 +561,23 @@ func HandleWebSocket(c *gin.Context) {
 
 	connID := generateConnID()
 	client := &Client{
-		ID:     userID,
-		ConnID: connID,
-		Conn:   conn,
-		Send:   make(chan []byte, 256),
-		Rooms:  make(map[uint]bool),
+		ID:        userID,
+		SessionID: ticket.SessionID,
+		ConnID:    connID,
+		Conn:      conn,
+		Send:      make(chan []byte, 256),
+		Rooms:     make(map[uint]bool),
+		cfg:       c.MustGet("config").(*config.Config),
+		typing:    newTypingLimiter(),
 	}
 
 	hub.register <- client
 
+	// 记录会话的最后使用时间
+	if err := service.NewAuthService().TouchSession(client.SessionID); err != nil {
+		log.Printf("更新会话时间失败: %v", err)
+	}
+
 	// 设置用户在线
 	roomIDs := getUserRoomIDs(userID)
 	cache.SetUserOnline(context.Background(), userID, connID, roomIDs)
@@ -191,6 +588,10 @@ func HandleWebSocket(c *gin.Context) {
 
 func (c *Client) readPump() {
 	defer func() {
+		// 断开时结束该连接的输入状态，不必等待过期
+		for _, roomID := range c.typing.typingRooms() {
+			publishTyping(roomID, c.ID, false)
+		}
 		hub.unregister <- c
 		c.Conn.Close()
 	}()
@@ -218,7 +619,8 @@ func (c *Client) readPump() {
 		switch wsMsg.Type {
 		case "join_room":
 			roomID := wsMsg.RoomID
-			if isValidRoomMember(c.ID, roomID) {
+			access, err := service.GetRoomAccess(c.ID, roomID)
+			if err == nil && access.CanView() {
 				hub.JoinRoom(c, roomID)
 				c.SendMessage(WSMessage{
 					Type:    "room_joined",
@@ -235,6 +637,9 @@ func (c *Client) readPump() {
 			}
 
 		case "leave_room":
+			if c.typing.allow(wsMsg.RoomID, false, time.Now()) {
+				publishTyping(wsMsg.RoomID, c.ID, false)
+			}
 			hub.LeaveRoom(c, wsMsg.RoomID)
 			c.SendMessage(WSMessage{
 				Type:    "room_left",
@@ -245,37 +650,107 @@ func (c *Client) readPump() {
 
 		case "message":
 			roomID := wsMsg.RoomID
-			if c.Rooms[roomID] {
+			if hub.isInRoom(c, roomID) {
+				content, ok := wsMsg.Content.(string)
+				if !ok || content == "" {
+					c.sendError("消息内容无效")
+					continue
+				}
+
+				// 角色和房间设置可能在加入后发生变化，每条消息都重新校验
+				access, err := service.GetRoomAccess(c.ID, roomID)
+				if err != nil || !access.CanPostMessage() {
+					if err == nil && access.IsArchived() {
+						c.sendError("房间已归档，不能发送消息")
+					} else {
+						c.sendError("没有在该房间发言的权限")
+					}
+					continue
+				}
+
 				// 保存消息到数据库
 				msg := &models.Message{
-					RoomID:   roomID,
-					SenderID: c.ID,
-					Content:  wsMsg.Content.(string),
-					Type:     "text",
+					RoomID:    roomID,
+					SenderID:  c.ID,
+					Content:   content,
+					Type:      "text",
+					ReplyToID: wsMsg.ReplyToID,
 				}
 
-				if err := database.GetDB().Create(msg).Error; err != nil {
-					log.Printf("消息保存失败: %v", err)
+				root, err := service.NewMessageService().SendMessage(msg)
+				if err != nil {
+					c.sendServiceError(err, "消息保存失败", service.ErrReplyTargetNotFound)
 					continue
 				}
 
-				// 广播消息到房间
-				messageData := WSMessage{
-					Type:     "new_message",
-					RoomID:   roomID,
-					SenderID: c.ID,
-					Content:  wsMsg.Content,
-					Time:     time.Now(),
+				PublishMessage(msg, root)
+
+				// 发送消息后结束输入状态
+				if c.typing.allow(roomID, false, time.Now()) {
+					publishTyping(roomID, c.ID, false)
 				}
+			}
 
-				data, _ := json.Marshal(messageData)
-				hub.BroadcastToRoom(roomID, data)
+		case "edit_message":
+			content, ok := wsMsg.Content.(string)
+			if !ok || content == "" {
+				c.sendError("消息内容无效")
+				continue
+			}
 
-				// 缓存消息
-				cache.CacheMessage(context.Background(), roomID, messageData)
+			window := time.Duration(c.cfg.Message.EditWindowMinute) * time.Minute
+			msg, mentions, err := service.NewMessageService().EditMessage(wsMsg.MessageID, c.ID, content, window)
+			if err != nil {
+				c.sendServiceError(err, "消息编辑失败", service.ErrMessageNotFound, service.ErrNotMessageSender,
+					service.ErrMessageNotEditable, service.ErrEditWindowExpired, service.ErrRoomArchived, service.ErrPermissionDenied,
+					service.ErrMessageTooLong)
+				continue
+			}
 
-				// 更新未读消息计数
-				updateUnreadCounts(roomID, c.ID, msg.ID)
+			PublishMessageEdited(msg, mentions)
+
+		case "add_reaction", "remove_reaction":
+			emoji, _ := wsMsg.Content.(string)
+			messageService := service.NewMessageService()
+
+			var change *service.ReactionChange
+			var err error
+			eventType := "reaction_added"
+			if wsMsg.Type == "add_reaction" {
+				change, err = messageService.AddReaction(wsMsg.MessageID, c.ID, emoji)
+			} else {
+				change, err = messageService.RemoveReaction(wsMsg.MessageID, c.ID, emoji)
+				eventType = "reaction_removed"
+			}
+			if err != nil {
+				c.sendServiceError(err, "表情回应失败", service.ErrInvalidEmoji, service.ErrMessageNotFound, service.ErrRoomArchived)
+				continue
+			}
+
+			PublishReaction(eventType, change)
+
+		case "typing_start", "typing_stop":
+			// 输入状态不保存，只广播给房间内的其他连接
+			if !hub.isInRoom(c, wsMsg.RoomID) {
+				continue
+			}
+			isTyping := wsMsg.Type == "typing_start"
+			if c.typing.allow(wsMsg.RoomID, isTyping, time.Now()) {
+				publishTyping(wsMsg.RoomID, c.ID, isTyping)
+			}
+
+		case "ack_delivered", "ack_read":
+			status := models.ReceiptDelivered
+			if wsMsg.Type == "ack_read" {
+				status = models.ReceiptRead
+			}
+			receipt, err := service.NewMessageService().AckMessage(c.ID, wsMsg.RoomID, wsMsg.MessageID, status)
+			if err != nil {
+				c.sendServiceError(err, "更新消息回执失败", service.ErrMessageNotFound, service.ErrNotRoomMember)
+				continue
+			}
+			if receipt != nil {
+				PublishReadReceipt(receipt)
 			}
 		}
 	}
@@ -319,6 +794,25 @@ func (c *Client) SendMessage(msg WSMessage) {
 	}
 }
 
+func (c *Client) sendError(content string) {
+	c.SendMessage(WSMessage{
+		Type:    "error",
+		Content: content,
+		Time:    time.Now(),
+	})
+}
+
+// sendServiceError 将known中的业务错误返回给客户端，其他错误只记录日志
+func (c *Client) sendServiceError(err error, action string, known ...error) {
+	for _, target := range known {
+		if errors.Is(err, target) {
+			c.sendError(err.Error())
+			return
+		}
+	}
+	log.Printf("%s: %v", action, err)
+}
+
 func generateConnID() string {
 	return time.Now().Format("20060102150405") + "-" + randomString(8)
 }
@@ -340,14 +834,6 @@ func getUserRoomIDs(userID uint) []uint {
 	return roomIDs
 }
 
-func isValidRoomMember(userID, roomID uint) bool {
-	var count int64
-	database.GetDB().Model(&models.RoomMember{}).
-		Where("user_id = ? AND room_id = ?", userID, roomID).
-		Count(&count)
-	return count > 0
-}
-
 func updateUnreadCounts(roomID, senderID, messageID uint) {
 	var members []models.RoomMember
 	database.GetDB().Where("room_id = ? AND user_id != ?", roomID, senderID).
@@ -366,4 +852,6 @@ func updateUnreadCounts(roomID, senderID, messageID uint) {
 
 func StartHub() {
 	go hub.Run()
+	go subscribeTyping()
+	go subscribeControl()
 }
@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"chat-service/pkg/cache"
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	typingChannel = "ws:typing"
+
+	// typingTTL 超过该时间没有再次收到typing_start时视为停止输入
+	typingTTL = 5 * time.Second
+	// typingRefreshInterval 同一房间内重复的typing_start至少间隔该时间才会广播
+	typingRefreshInterval = 2 * time.Second
+	// typingRateLimit 每个连接每秒最多广播的输入状态次数
+	typingRateLimit = 5
+)
+
+// typingEvent 在实例之间同步的输入状态
+type typingEvent struct {
+	RoomID uint `json:"room_id"`
+	UserID uint `json:"user_id"`
+	Typing bool `json:"typing"`
+}
+
+// typingLimiter 单个连接的输入状态限流，只在该连接的readPump中使用，不需要加锁
+type typingLimiter struct {
+	windowStart time.Time
+	count       int
+	rooms       map[uint]time.Time // 正在输入的房间 -> 上次广播typing_start的时间
+}
+
+func newTypingLimiter() *typingLimiter {
+	return &typingLimiter{rooms: make(map[uint]time.Time)}
+}
+
+// allow 判断是否需要广播本次输入状态。重复的typing_start、没有开始输入时的typing_stop和超出频率的事件被丢弃
+func (l *typingLimiter) allow(roomID uint, typing bool, now time.Time) bool {
+	if now.Sub(l.windowStart) >= time.Second {
+		l.windowStart = now
+		l.count = 0
+	}
+	if l.count >= typingRateLimit {
+		return false
+	}
+
+	last, active := l.rooms[roomID]
+	if typing {
+		if active && now.Sub(last) < typingRefreshInterval {
+			return false
+		}
+		l.rooms[roomID] = now
+	} else {
+		if !active {
+			return false
+		}
+		delete(l.rooms, roomID)
+	}
+	l.count++
+	return true
+}
+
+// typingRooms 返回正在输入的房间并清空状态，用于连接断开时发送typing_stop
+func (l *typingLimiter) typingRooms() []uint {
+	roomIDs := make([]uint, 0, len(l.rooms))
+	for roomID := range l.rooms {
+		roomIDs = append(roomIDs, roomID)
+	}
+	l.rooms = make(map[uint]time.Time)
+	return roomIDs
+}
+
+// typingTracker 本实例上正在输入的用户，到期没有刷新时向本地连接广播typing_stop
+type typingTracker struct {
+	mu     sync.Mutex
+	timers map[typingEvent]*time.Timer // Typing固定为false作为key
+}
+
+var typing = &typingTracker{timers: make(map[typingEvent]*time.Timer)}
+
+// publishTyping 将输入状态发布给所有实例，Redis不可用时只在本实例内广播
+func publishTyping(roomID, userID uint, isTyping bool) {
+	event := typingEvent{RoomID: roomID, UserID: userID, Typing: isTyping}
+	if err := cache.Publish(context.Background(), typingChannel, event); err != nil {
+		log.Printf("发布输入状态失败: %v", err)
+		typing.deliver(event)
+	}
+}
+
+// subscribeTyping 接收所有实例发布的输入状态并广播给本实例的连接
+func subscribeTyping() {
+	pubsub, err := cache.Subscribe(context.Background(), typingChannel)
+	if err != nil {
+		log.Printf("订阅输入状态失败，输入状态只在本实例内广播: %v", err)
+		return
+	}
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var event typingEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			continue
+		}
+		typing.deliver(event)
+	}
+}
+
+// deliver 向本实例房间内除输入者以外的连接广播，typing_start会在typingTTL后自动过期
+func (t *typingTracker) deliver(event typingEvent) {
+	key := typingEvent{RoomID: event.RoomID, UserID: event.UserID}
+
+	t.mu.Lock()
+	if timer, ok := t.timers[key]; ok {
+		timer.Stop()
+		delete(t.timers, key)
+	}
+	if event.Typing {
+		var timer *time.Timer
+		timer = time.AfterFunc(typingTTL, func() {
+			t.mu.Lock()
+			// 到期的同时收到了新的输入状态，以新的为准
+			if t.timers[key] != timer {
+				t.mu.Unlock()
+				return
+			}
+			delete(t.timers, key)
+			t.mu.Unlock()
+			broadcastTyping(key)
+		})
+		t.timers[key] = timer
+	}
+	t.mu.Unlock()
+
+	broadcastTyping(event)
+}
+
+func broadcastTyping(event typingEvent) {
+	msg := WSMessage{
+		Type:     "typing_stop",
+		RoomID:   event.RoomID,
+		SenderID: event.UserID,
+		Time:     time.Now(),
+	}
+	if event.Typing {
+		msg.Type = "typing_start"
+		msg.Content = gin.H{"expires_in": int(typingTTL.Seconds())}
+	}
+	data, _ := json.Marshal(msg)
+	hub.BroadcastToRoomExcept(event.RoomID, event.UserID, data)
+}
@@ -0,0 +1,39 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypingLimiter(t *testing.T) {
+	now := time.Now()
+	l := newTypingLimiter()
+
+	// 没有开始输入时的typing_stop不广播
+	assert.False(t, l.allow(1, false, now))
+
+	assert.True(t, l.allow(1, true, now))
+	// 刷新间隔内重复的typing_start不广播
+	assert.False(t, l.allow(1, true, now.Add(time.Second)))
+	assert.True(t, l.allow(1, true, now.Add(typingRefreshInterval+time.Second)))
+
+	assert.True(t, l.allow(1, false, now.Add(4*time.Second)))
+	assert.False(t, l.allow(1, false, now.Add(4*time.Second)))
+}
+
+func TestTypingLimiterRate(t *testing.T) {
+	now := time.Now()
+	l := newTypingLimiter()
+
+	for roomID := uint(1); roomID <= typingRateLimit; roomID++ {
+		assert.True(t, l.allow(roomID, true, now))
+	}
+	assert.False(t, l.allow(100, true, now))
+
+	// 下一秒重新计数
+	assert.True(t, l.allow(100, true, now.Add(time.Second)))
+	assert.ElementsMatch(t, []uint{1, 2, 3, 4, 5, 100}, l.typingRooms())
+	assert.Empty(t, l.typingRooms())
+}
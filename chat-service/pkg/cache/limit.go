@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Throttle 在interval内对同一个key只放行一次，返回是否放行
+func Throttle(ctx context.Context, key string, interval time.Duration) (bool, error) {
+	return RedisClient.SetNX(ctx, fmt.Sprintf("throttle:%s", key), 1, interval).Result()
+}
+
+// IncrWithTTL 计数加一，首次计数时设置过期时间，返回当前计数
+func IncrWithTTL(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	key = fmt.Sprintf("counter:%s", key)
+	count, err := RedisClient.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := RedisClient.Expire(ctx, key, ttl).Err(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// ResetCounter 清除IncrWithTTL的计数
+func ResetCounter(ctx context.Context, key string) error {
+	return RedisClient.Del(ctx, fmt.Sprintf("counter:%s", key)).Err()
+}
+
+// Block 在duration内标记key为封禁状态
+func Block(ctx context.Context, key string, duration time.Duration) error {
+	return RedisClient.Set(ctx, fmt.Sprintf("block:%s", key), 1, duration).Err()
+}
+
+// Unblock 解除封禁
+func Unblock(ctx context.Context, keys ...string) error {
+	for i, key := range keys {
+		keys[i] = fmt.Sprintf("block:%s", key)
+	}
+	return RedisClient.Del(ctx, keys...).Err()
+}
+
+// BlockedFor 返回key剩余的封禁时间，未封禁时为0
+func BlockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := RedisClient.PTTL(ctx, fmt.Sprintf("block:%s", key)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
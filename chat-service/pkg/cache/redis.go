@@ -4,6 +4,7 @@ import (
 	"chat-service/internal/config"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -50,11 +51,51 @@ func Get(ctx context.Context, key string, dest interface{}) error {
 	return json.Unmarshal([]byte(data), dest)
 }
 
+// Take 获取缓存并立即删除，保证同一个值只能被取出一次
+func Take(ctx context.Context, key string, dest interface{}) error {
+	pipe := RedisClient.TxPipeline()
+	get := pipe.Get(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(get.Val()), dest)
+}
+
 // Delete 删除缓存
 func Delete(ctx context.Context, keys ...string) error {
 	return RedisClient.Del(ctx, keys...).Err()
 }
 
+// ErrNotInitialized Redis尚未初始化
+var ErrNotInitialized = errors.New("Redis未初始化")
+
+// Publish 将消息序列化后发布到频道，用于多个实例之间同步
+func Publish(ctx context.Context, channel string, message interface{}) error {
+	if RedisClient == nil {
+		return ErrNotInitialized
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return RedisClient.Publish(ctx, channel, data).Err()
+}
+
+// Subscribe 订阅频道，连接断开后会自动重新订阅
+func Subscribe(ctx context.Context, channels ...string) (*redis.PubSub, error) {
+	if RedisClient == nil {
+		return nil, ErrNotInitialized
+	}
+	pubsub := RedisClient.Subscribe(ctx, channels...)
+	// 等待订阅确认，保证之后发布的消息不会丢失
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	return pubsub, nil
+}
+
 // SetUserOnline 设置用户在线状态
 func SetUserOnline(ctx context.Context, userID uint, connID string, roomIDs []uint) error {
 	key := fmt.Sprintf("user:online:%d", userID)
@@ -110,6 +151,11 @@ func RemoveUserFromRoom(ctx context.Context, roomID, userID uint) error {
 	return RedisClient.SRem(ctx, key, userID).Err()
 }
 
+// ClearRoom 删除房间的在线用户和最近消息缓存
+func ClearRoom(ctx context.Context, roomID uint) error {
+	return Delete(ctx, fmt.Sprintf("room:users:%d", roomID), fmt.Sprintf("room:messages:%d", roomID))
+}
+
 // CacheMessage 缓存最近消息
 func CacheMessage(ctx context.Context, roomID uint, message interface{}) error {
 	key := fmt.Sprintf("room:messages:%d", roomID)
@@ -145,3 +191,37 @@ func GetCachedMessages(ctx context.Context, roomID uint, limit int) ([]interface
 	}
 	return result, nil
 }
+
+// UpdateCachedMessage 修改缓存中message_id对应的消息，消息不在缓存中时忽略
+func UpdateCachedMessage(ctx context.Context, roomID, messageID uint, update func(msg map[string]interface{})) error {
+	key := fmt.Sprintf("room:messages:%d", roomID)
+	// 使用WATCH避免修改期间有新消息写入导致下标错位
+	return RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+		data, err := tx.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		for i, item := range data {
+			var msg map[string]interface{}
+			if err := json.Unmarshal([]byte(item), &msg); err != nil {
+				continue
+			}
+			if id, _ := msg["message_id"].(float64); uint(id) != messageID {
+				continue
+			}
+
+			update(msg)
+			updated, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.LSet(ctx, key, int64(i), updated)
+				return nil
+			})
+			return err
+		}
+		return nil
+	}, key)
+}
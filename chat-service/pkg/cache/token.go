@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RevokeToken 将access token的jti加入黑名单，ttl为token剩余有效期
+func RevokeToken(ctx context.Context, jti string, ttl time.Duration) error {
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	key := fmt.Sprintf("auth:revoked:%s", jti)
+	return RedisClient.Set(ctx, key, 1, ttl).Err()
+}
+
+// RevokeSession 标记会话已吊销，ttl应不小于access token的有效期，
+// 以便该会话已签发的access token全部失效
+func RevokeSession(ctx context.Context, sessionID uint, ttl time.Duration) error {
+	if sessionID == 0 || ttl <= 0 {
+		return nil
+	}
+	key := fmt.Sprintf("auth:session_revoked:%d", sessionID)
+	return RedisClient.Set(ctx, key, 1, ttl).Err()
+}
+
+// IsTokenRevoked 检查access token的jti或其所属会话是否已被吊销
+func IsTokenRevoked(ctx context.Context, jti string, sessionID uint) (bool, error) {
+	// 未初始化Redis（如单元测试）时无法吊销
+	if RedisClient == nil {
+		return false, nil
+	}
+
+	var keys []string
+	if jti != "" {
+		keys = append(keys, fmt.Sprintf("auth:revoked:%s", jti))
+	}
+	if sessionID != 0 {
+		keys = append(keys, fmt.Sprintf("auth:session_revoked:%d", sessionID))
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+
+	n, err := RedisClient.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"chat-service/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WSTicketTTL WebSocket连接票据的有效期
+const WSTicketTTL = 30 * time.Second
+
+var ErrWSTicketInvalid = errors.New("无效或已使用的连接票据")
+
+// WSTicket 建立WebSocket连接用的一次性票据，保存签发时的认证信息
+type WSTicket struct {
+	UserID    uint   `json:"user_id"`
+	SessionID uint   `json:"session_id"`
+	TokenID   string `json:"token_id"`
+}
+
+// CreateWSTicket 保存票据并返回明文，Redis中只保存其哈希
+func CreateWSTicket(ctx context.Context, ticket *WSTicket) (string, error) {
+	raw := utils.GenerateRandomString(48)
+	if err := Set(ctx, wsTicketKey(raw), ticket, WSTicketTTL); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// ConsumeWSTicket 取出并删除票据，每个票据只能使用一次
+func ConsumeWSTicket(ctx context.Context, raw string) (*WSTicket, error) {
+	if raw == "" {
+		return nil, ErrWSTicketInvalid
+	}
+	var ticket WSTicket
+	if err := Take(ctx, wsTicketKey(raw), &ticket); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrWSTicketInvalid
+		}
+		return nil, err
+	}
+	return &ticket, nil
+}
+
+func wsTicketKey(raw string) string {
+	return fmt.Sprintf("ws_ticket:%s", utils.HashToken(raw))
+}
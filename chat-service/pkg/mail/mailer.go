@@ -0,0 +1,120 @@
+package mail
+
+import (
+	"chat-service/internal/config"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer 邮件发送接口，不同的投递方式实现该接口
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+var defaultMailer Mailer = &LogMailer{}
+
+// InitMailer 根据配置初始化默认的邮件发送器
+func InitMailer(cfg *config.MailConfig) error {
+	switch cfg.Driver {
+	case "smtp":
+		defaultMailer = NewSMTPMailer(cfg)
+	case "file":
+		defaultMailer = NewFileMailer(cfg.FilePath)
+	case "log", "":
+		defaultMailer = &LogMailer{}
+	default:
+		return fmt.Errorf("不支持的邮件驱动: %s", cfg.Driver)
+	}
+	return nil
+}
+
+// SetMailer 替换默认的邮件发送器
+func SetMailer(m Mailer) {
+	defaultMailer = m
+}
+
+// Send 使用默认的邮件发送器发送邮件
+func Send(to, subject, body string) error {
+	return defaultMailer.Send(to, subject, body)
+}
+
+// SMTPMailer 通过SMTP服务器发送邮件
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(cfg *config.MailConfig) *SMTPMailer {
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		auth: auth,
+		from: cfg.From,
+	}
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		// 非ASCII的标题需要按RFC 2047编码
+		"Subject: " + mime.QEncoding.Encode("UTF-8", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("邮件发送失败: %v", err)
+	}
+	return nil
+}
+
+// FileMailer 将邮件追加写入本地文件，用于开发和测试
+type FileMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(path string) *FileMailer {
+	return &FileMailer{path: path}
+}
+
+func (m *FileMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("邮件文件打开失败: %v", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n---\n",
+		time.Now().Format(time.RFC3339), to, subject, body)
+	return err
+}
+
+// linkTokenPattern 匹配邮件链接中的token参数
+var linkTokenPattern = regexp.MustCompile(`([?&]token=)[^\s&]+`)
+
+// LogMailer 将邮件内容输出到日志，用于本地开发。链接中的token会被隐藏，
+// 需要完整链接时使用file驱动
+type LogMailer struct{}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	log.Printf("邮件 -> %s [%s]\n%s", to, subject, linkTokenPattern.ReplaceAllString(body, "${1}***"))
+	return nil
+}
@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"chat-service/internal/config"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockIdP 本地模拟的OIDC身份提供方，记录授权请求中的code_challenge和nonce
+type mockIdP struct {
+	server      *httptest.Server
+	key         *rsa.PrivateKey
+	kid         string
+	challenge   string
+	nonce       string
+	jwksFetches int32
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	idp := &mockIdP{key: key, kid: "test-key"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&idp.jwksFetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "auth-code" || CodeChallenge(r.Form.Get("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.signIDToken(t, idp.nonce)})
+	})
+	idp.server = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *mockIdP) signIDToken(t *testing.T, nonce string) string {
+	claims := IDTokenClaims{
+		Email:             "alice@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "alice",
+		Nonce:             nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.server.URL,
+			Subject:   "user-123",
+			Audience:  jwt.ClaimStrings{"chat-service"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+
+	provider := NewProvider(&config.OIDCConfig{
+		Issuer:      idp.server.URL,
+		ClientID:    "chat-service",
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+	ctx := context.Background()
+
+	verifier, err := GenerateCodeVerifier()
+	require.NoError(t, err)
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+	idp.challenge = parsed.Query().Get("code_challenge")
+	idp.nonce = parsed.Query().Get("nonce")
+
+	claims, err := provider.Exchange(ctx, "auth-code", verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", claims.Subject)
+	assert.Equal(t, "alice@example.com", claims.Email)
+	assert.True(t, claims.EmailVerified)
+
+	// code_verifier不匹配时IdP拒绝换取token
+	_, err = provider.Exchange(ctx, "auth-code", "wrong-verifier", "nonce-1")
+	assert.Error(t, err)
+
+	// nonce不匹配时拒绝ID token
+	_, err = provider.VerifyIDToken(ctx, idp.signIDToken(t, "other-nonce"), "nonce-1")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestUnknownKidDoesNotRefetchJWKS(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.server.Close()
+
+	provider := NewProvider(&config.OIDCConfig{Issuer: idp.server.URL, ClientID: "chat-service"})
+	ctx := context.Background()
+
+	_, err := provider.VerifyIDToken(ctx, idp.signIDToken(t, "nonce-1"), "nonce-1")
+	require.NoError(t, err)
+
+	// 伪造的kid在刷新间隔内不会再次拉取JWKS
+	idp.kid = "bogus"
+	for i := 0; i < 5; i++ {
+		_, err = provider.VerifyIDToken(ctx, idp.signIDToken(t, "nonce-1"), "nonce-1")
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&idp.jwksFetches))
+}
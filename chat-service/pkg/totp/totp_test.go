@@ -0,0 +1,45 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	// RFC 6238 附录B中SHA1的测试向量（取后6位）
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for ts, want := range vectors {
+		code, err := Code(secret, time.Unix(ts, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, want, code, "时间戳 %d", ts)
+	}
+}
+
+func TestValidateWithSkew(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	previous, _ := Code(secret, now.Add(-Period*time.Second))
+
+	_, ok := Validate(secret, previous, now, 1)
+	assert.True(t, ok)
+
+	_, ok = Validate(secret, previous, now, 0)
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now, 1)
+	assert.False(t, ok)
+}
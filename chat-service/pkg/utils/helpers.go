@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"regexp"
@@ -130,3 +131,9 @@ func TimeAgo(t interface{}) string {
 	// 例如：1分钟前、2小时前等
 	return fmt.Sprintf("%v", t)
 }
+
+// HashToken 计算token的SHA-256摘要，用于只存储哈希的凭证
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}